@@ -1,29 +1,75 @@
 package main
 
 import(
-  "github.com/premshree/lib-slackbot"
+  "flag"
+  "log"
+  "net/http"
+  "os"
+
+  "github.com/premshree/slackbots/slackbot"
   "github.com/premshree/slackbots"
-  "github.com/spf13/viper"
 )
 
-var (
-  slackToken string
-)
+func main() {
+  configFile := flag.String("config", slackbots.DEFAULT_CONFIG_FILE, "path to the config file")
+  webhookAddr := flag.String("webhook-addr", "", "where to listen for webhooks, overrides webhook_addr")
+  flag.Parse()
 
-func init() {
-  viper := viper.New()
-  viper.SetEnvPrefix("omnibot")
-  viper.AutomaticEnv()
-  viper.ReadInConfig()
-  slackToken = viper.GetString("slack_token")
-}
+  config, err := slackbots.LoadConfig(*configFile)
+  if err != nil {
+    log.Fatalf("Error loading config: %v", err)
+  }
+  if err := config.Validate(); err != nil {
+    log.Fatalf("Invalid config: %v", err)
+  }
+  if *webhookAddr != "" {
+    config.WebhookAddr = *webhookAddr
+  }
+  if config.WebhookAddr == "" && os.Getenv("PORT") != "" {
+    config.WebhookAddr = ":" + os.Getenv("PORT")
+  }
+  if config.WebhookAddr == "" {
+    config.WebhookAddr = ":8080"
+  }
+  slackbots.Configure(config)
 
-func main() {
-  bot := slackbot.New(slackToken)
+  bot := slackbot.New(config.SlackToken)
+
+  if config.PagerDuty.Enabled() {
+    bot.AddCommand("?oncall", "Who's on call: ?oncall [team] [next|week|override @user 4h|override cancel]", slackbots.PagerDutyOnCall)
+    bot.AddCommand("?incidents", "Open PagerDuty incidents for this channel", slackbots.PagerDutyIncidents)
+    bot.AddMessageCommand("?ack", "Usage: ?ack <incident>", slackbots.PagerDutyAck)
+    bot.AddMessageCommand("?resolve", "Usage: ?resolve <incident>", slackbots.PagerDutyResolve)
+    bot.AddMessageCommand("?page", "Usage: ?page service description", slackbots.PagerDutyPage)
+    bot.AddMessageCommand("?maintenance", "Usage: ?maintenance 30m reason | list | end <id>", slackbots.PagerDutyMaintenance)
+    slackbots.WarnUnmatchedChannels(bot)
+    if config.PagerDuty.WebhookSecret != "" {
+      http.HandleFunc("/pagerduty", slackbots.PagerDutyWebhook(bot))
+    } else {
+      log.Printf("pagerduty.webhook_secret isn't set, so PagerDuty webhooks are off")
+    }
+  } else {
+    log.Printf("PagerDuty isn't configured, leaving out its commands")
+  }
+  if config.Weather.Enabled() {
+    bot.AddMessageCommand("?weather", "Usage: ?weather [forecast|tomorrow] [metric|imperial|standard] [zipcode | zipcode,country | city | lat,lon]", slackbots.Weather)
+    go slackbots.WatchWeatherAlerts(bot)
+  } else {
+    log.Printf("The weather isn't configured, leaving out its commands")
+  }
+  if config.Jira.Enabled() {
+    bot.AddMessageCommand("?jiracreate", "Usage: ?jiracreate KEY summary [type:Task] [priority:High] [label:x] [component:x] [@asignee|@me] [desc: details]. In a thread, the thread goes in the description.", slackbots.JiraCreate)
+    bot.AddMessageCommand("?jira", "Usage: ?jira search <JQL> | mine | filter [name] | more | move KEY <status> | comment KEY <text> | assign KEY @user | login | logout", slackbots.Jira)
+    bot.AddListener(slackbots.JiraUnfurl)
+    http.HandleFunc("/jira/oauth", slackbots.JiraOAuthCallback(bot))
+  } else {
+    log.Printf("Jira isn't configured, leaving out its commands")
+  }
 
-  bot.AddCommand("?oncall", "Who's on call", slackbots.PagerDutyOnCall)
-  bot.AddCommand("?weather", "Usage: ?weather zipcode", slackbots.Weather)
-  bot.AddCommand("?jiracreate", "Usage: ?jiracreate KEY summary @asignee", slackbots.JiraCreate)
+  go func() {
+    log.Printf("Listening for webhooks on %s", config.WebhookAddr)
+    log.Fatal(http.ListenAndServe(config.WebhookAddr, nil))
+  }()
 
   bot.Run()
 }
@@ -0,0 +1,160 @@
+package slackbots
+
+import(
+  "fmt"
+  "strings"
+
+  "github.com/spf13/viper"
+)
+
+const (
+  CONFIG_ENV_PREFIX = "omnibot"
+  DEFAULT_CONFIG_FILE = "./config/omnibot.json"
+)
+
+// Config is all of omnibot's settings. Everything can be set in the config
+// file, and the settings in configEnvKeys can also be set in the environment
+// as OMNIBOT_ plus the key, e.g. OMNIBOT_JIRA_BASE_URL for jira.base_url.
+type Config struct {
+  SlackToken string `mapstructure:"slack_token"`
+  WebhookAddr string `mapstructure:"webhook_addr"` // where to listen for webhooks and OAuth, e.g. :8080
+  PagerDuty PagerDutyConfig `mapstructure:"pagerduty"`
+  Jira JiraConfig `mapstructure:"jira"`
+  Weather WeatherConfig `mapstructure:"weather"`
+}
+
+// configEnvKeys are the settings that can come from the environment, mostly
+// secrets that shouldn't be in the config file.
+var configEnvKeys = []string{
+  "slack_token",
+  "webhook_addr",
+  "pagerduty.token",
+  "pagerduty.webhook_secret",
+  "jira.base_url",
+  "jira.auth",
+  "jira.email",
+  "jira.api_token",
+  "jira.pat",
+  "jira.oauth_client_id",
+  "jira.oauth_client_secret",
+  "jira.oauth_redirect_url",
+  "weather.owm_token",
+  "weather.owm_base_url",
+}
+
+// LoadConfig reads the config file at path, DEFAULT_CONFIG_FILE if it's
+// empty, then the environment on top of it.
+func LoadConfig(path string) (Config, error) {
+  var cfg Config
+  if path == "" {
+    path = DEFAULT_CONFIG_FILE
+  }
+  viper := viper.New()
+  viper.SetConfigFile(path)
+  viper.SetEnvPrefix(CONFIG_ENV_PREFIX)
+  viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+  for _, key := range configEnvKeys {
+    viper.BindEnv(key)
+  }
+  if err := viper.ReadInConfig(); err != nil {
+    return cfg, fmt.Errorf("reading %s: %v", path, err)
+  }
+  if err := viper.Unmarshal(&cfg); err != nil {
+    return cfg, fmt.Errorf("decoding %s: %v", path, err)
+  }
+
+  return cfg, nil
+}
+
+// Validate reports every required setting that's missing, rather than just
+// the first, so a new deployment can be fixed in one go. Only the
+// integrations that have some settings are checked, the rest are left off.
+func (cfg Config) Validate() error {
+  var missing []string
+  if cfg.SlackToken == "" {
+    missing = append(missing, getConfigKeyName("slack_token"))
+  }
+  if cfg.PagerDuty.Enabled() {
+    missing = append(missing, cfg.PagerDuty.getMissingSettings()...)
+  }
+  if cfg.Jira.Enabled() {
+    missing = append(missing, cfg.Jira.getMissingSettings()...)
+  }
+  if cfg.Weather.Enabled() {
+    missing = append(missing, cfg.Weather.getMissingSettings()...)
+  }
+  if len(missing) > 0 {
+    return fmt.Errorf("missing settings: %s", strings.Join(missing, "; "))
+  }
+
+  return nil
+}
+
+func (cfg PagerDutyConfig) getMissingSettings() []string {
+  var missing []string
+  if cfg.Token == "" {
+    missing = append(missing, getConfigKeyName("pagerduty.token"))
+  }
+
+  return missing
+}
+
+func (cfg JiraConfig) getMissingSettings() []string {
+  var missing []string
+  if cfg.BaseURL == "" {
+    missing = append(missing, getConfigKeyName("jira.base_url"))
+  }
+  if isJiraCloudURL(cfg.BaseURL) {
+    // Jira Cloud doesn't take personal access tokens, so jira.pat doesn't count
+    if cfg.Auth == "" && (cfg.Email == "" || cfg.APIToken == "") {
+      missing = append(missing, fmt.Sprintf("%s and %s, or %s", getConfigKeyName("jira.email"), getConfigKeyName("jira.api_token"), getConfigKeyName("jira.auth")))
+    }
+  } else if cfg.PAT == "" && cfg.Auth == "" && (cfg.Email == "" || cfg.APIToken == "") {
+    missing = append(missing, fmt.Sprintf("%s, %s and %s, or %s", getConfigKeyName("jira.pat"), getConfigKeyName("jira.email"), getConfigKeyName("jira.api_token"), getConfigKeyName("jira.auth")))
+  }
+  if cfg.OAuthClientID != "" {
+    if cfg.OAuthClientSecret == "" {
+      missing = append(missing, getConfigKeyName("jira.oauth_client_secret"))
+    }
+    if cfg.OAuthRedirectURL == "" {
+      missing = append(missing, getConfigKeyName("jira.oauth_redirect_url"))
+    }
+  }
+
+  return missing
+}
+
+func (cfg WeatherConfig) getMissingSettings() []string {
+  var missing []string
+  if cfg.OWMToken == "" {
+    missing = append(missing, getConfigKeyName("weather.owm_token"))
+  }
+
+  return missing
+}
+
+// Configure hands each command its settings. Call it before adding commands.
+func Configure(cfg Config) {
+  configurePagerDuty(cfg.PagerDuty)
+  configureJira(cfg.Jira)
+  configureWeather(cfg.Weather)
+}
+
+// isSlackUser reports whether slackUser, from one of the config's users lists,
+// is the Slack user with slackUserID and slackUserName. It can be either, and
+// names are matched case-insensitively with or without the @.
+func isSlackUser(slackUser string, slackUserID string, slackUserName string) bool {
+  slackUser = strings.TrimPrefix(slackUser, "@")
+  if slackUser == "" {
+    return false
+  }
+
+  return slackUser == slackUserID || strings.EqualFold(slackUser, slackUserName)
+}
+
+// getConfigKeyName returns e.g. "jira.base_url (OMNIBOT_JIRA_BASE_URL)".
+func getConfigKeyName(key string) string {
+  env := strings.ToUpper(CONFIG_ENV_PREFIX + "_" + strings.Replace(key, ".", "_", -1))
+
+  return fmt.Sprintf("%s (%s)", key, env)
+}
@@ -0,0 +1,84 @@
+package slackbots
+
+import(
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+// loadTestConfig writes json to a config file and loads it.
+func loadTestConfig(t *testing.T, json string) Config {
+  dir, err := ioutil.TempDir("", "omnibot")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "omnibot.json")
+  if err := ioutil.WriteFile(path, []byte(json), 0600); err != nil {
+    t.Fatal(err)
+  }
+  cfg, err := LoadConfig(path)
+  if err != nil {
+    t.Fatalf("LoadConfig: %v", err)
+  }
+
+  return cfg
+}
+
+func TestLoadConfigPagerDutyUsers(t *testing.T) {
+  cfg := loadTestConfig(t, `{
+    "pagerduty": {
+      "users": [
+        {"slack_user": "john.doe", "email": "john@example.com"},
+        {"slack_user": "U024BE7LH", "email": "jane@example.com"}
+      ]
+    }
+  }`)
+
+  defer configurePagerDuty(pagerDutyConfig)
+  configurePagerDuty(cfg.PagerDuty)
+  tests := []struct {
+    userID string
+    userName string
+    email string
+  }{
+    {"U0JOHN", "John.Doe", "john@example.com"},
+    {"U024BE7LH", "jane", "jane@example.com"},
+    {"U0JOHNNY", "john", ""},
+  }
+  for _, test := range tests {
+    email, ok := getPagerDutyEmail(test.userID, test.userName)
+    if email != test.email || ok != (test.email != "") {
+      t.Errorf("getPagerDutyEmail(%q, %q) = %q, %v, want %q", test.userID, test.userName, email, ok, test.email)
+    }
+  }
+}
+
+func TestLoadConfigJiraUsers(t *testing.T) {
+  cfg := loadTestConfig(t, `{
+    "jira": {
+      "users": [
+        {"slack_user": "a.b", "account_id": "1"}
+      ]
+    }
+  }`)
+
+  if len(cfg.Jira.Users) != 1 || cfg.Jira.Users[0].SlackUser != "a.b" || cfg.Jira.Users[0].AccountID != "1" {
+    t.Errorf("jira.users = %+v, want a.b => 1", cfg.Jira.Users)
+  }
+}
+
+func TestLoadConfigWeatherUsers(t *testing.T) {
+  cfg := loadTestConfig(t, `{
+    "weather": {
+      "users": [
+        {"slack_user": "a.b", "location": "10001", "units": "metric"}
+      ]
+    }
+  }`)
+
+  if len(cfg.Weather.Users) != 1 || cfg.Weather.Users[0].SlackUser != "a.b" || cfg.Weather.Users[0].Location != "10001" {
+    t.Errorf("weather.users = %+v, want a.b => 10001", cfg.Weather.Users)
+  }
+}
@@ -0,0 +1,28 @@
+package slackbots
+
+import(
+  "fmt"
+  "log"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const TPL_ERROR_REPLY = "Sorry, I ran into a problem %s :disappointed:"
+
+// replyError is how commands fail: log the cause with context, tell the
+// channel what didn't work, and let the caller return. A command must never
+// log.Fatal or panic, since that takes the bot down for the whole workspace.
+//
+// action describes what the command was doing, e.g. "listing incidents for #%s".
+func replyError(bot *slackbot.Bot, channelID string, err error, action string, args ...interface{}) {
+  bot.Reply(channelID, getErrorReply(err, action, args...))
+}
+
+// getErrorReply logs err like replyError and returns the reply, for commands
+// that reply somewhere other than the channel, e.g. a thread.
+func getErrorReply(err error, action string, args ...interface{}) string {
+  action = fmt.Sprintf(action, args...)
+  log.Printf("Error %s: %v", action, err)
+
+  return fmt.Sprintf(TPL_ERROR_REPLY, action)
+}
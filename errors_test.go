@@ -0,0 +1,70 @@
+package slackbots
+
+import(
+  "fmt"
+  "net"
+  "net/http"
+  "testing"
+  "time"
+)
+
+const COMMAND_TIMEOUT = 10 * time.Second
+
+// failingBackend is one of the ways PagerDuty, Jira or OpenWeatherMap can
+// let a command down.
+type failingBackend struct {
+  name string
+  handler http.HandlerFunc
+}
+
+var failingBackends = []failingBackend{
+  {
+    name: "5xx",
+    handler: func(w http.ResponseWriter, r *http.Request) {
+      http.Error(w, "upstream connect error or disconnect/reset before headers", http.StatusServiceUnavailable)
+    },
+  },
+  {
+    name: "bad JSON",
+    handler: func(w http.ResponseWriter, r *http.Request) {
+      w.Header().Set("Content-Type", "application/json")
+      fmt.Fprint(w, `{"incidents":[{"id":`)
+    },
+  },
+  {
+    name: "connection reset",
+    handler: resetConnection,
+  },
+}
+
+// resetConnection drops the connection without a response.
+func resetConnection(w http.ResponseWriter, r *http.Request) {
+  hijacker, ok := w.(http.Hijacker)
+  if !ok {
+    http.Error(w, "can't hijack the connection", http.StatusInternalServerError)
+    return
+  }
+  conn, _, err := hijacker.Hijack()
+  if err != nil {
+    return
+  }
+  if tcpConn, ok := conn.(*net.TCPConn); ok {
+    tcpConn.SetLinger(0) // RST rather than FIN
+  }
+  conn.Close()
+}
+
+// runCommand runs command, failing the test if it doesn't return, since a
+// command that hangs on a failing backend is as bad as one that crashes.
+func runCommand(t *testing.T, command func()) {
+  done := make(chan struct{})
+  go func() {
+    defer close(done)
+    command()
+  }()
+  select {
+  case <-done:
+  case <-time.After(COMMAND_TIMEOUT):
+    t.Fatal("the command didn't return")
+  }
+}
@@ -0,0 +1,304 @@
+package slackbots
+
+import(
+  "bytes"
+  "crypto/rand"
+  "encoding/base64"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "log"
+  "net/http"
+  "net/url"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const (
+  JIRA_OAUTH_AUTHORIZE_URL = "https://auth.atlassian.com/authorize"
+  JIRA_OAUTH_TOKEN_URL = "https://auth.atlassian.com/oauth/token"
+  JIRA_OAUTH_RESOURCES_URL = "https://api.atlassian.com/oauth/token/accessible-resources"
+  JIRA_OAUTH_API_URL = "https://api.atlassian.com/ex/jira/%s" // cloud ID
+  JIRA_OAUTH_SCOPES = "read:jira-work write:jira-work read:jira-user offline_access"
+  JIRA_OAUTH_STATE_TTL = 10 * time.Minute
+  TPL_JIRA_LOGIN = "Log in to Jira so I can act as you: %s"
+  TPL_JIRA_LOGIN_SENT = "I've sent you a link to log in to Jira"
+  TPL_JIRA_LOGGED_IN = "You're logged in to %s, I'll create, move and comment on issues as you from now on"
+  TPL_JIRA_LOGGED_OUT = "Logged you out of Jira, I'll use my own account again"
+  TPL_JIRA_OAUTH_NOT_CONFIGURED = "Uh oh, Jira login isn't set up, ask an admin to configure an OAuth app"
+)
+
+// jiraOAuthToken is a Slack user's Jira Cloud access, from ?jira login.
+type jiraOAuthToken struct {
+  AccessToken string `json:"access_token"`
+  RefreshToken string `json:"refresh_token"`
+  ExpiresIn int `json:"expires_in"` // seconds
+  Expires time.Time `json:"-"`
+  CloudID string `json:"-"`
+  refreshMutex sync.Mutex // held while this token is being swapped for a new one
+}
+
+type jiraOAuthResource struct {
+  ID string `json:"id"`
+  URL string `json:"url"`
+  Name string `json:"name"`
+}
+
+type jiraOAuthState struct {
+  UserID string
+  Expires time.Time
+}
+
+var (
+  jiraOAuthMutex sync.Mutex
+  // Tokens only live in memory, so everyone needs to ?jira login again after a
+  // restart. Until they do, the bot's own account is used.
+  jiraOAuthTokens = make(map[string]*jiraOAuthToken) // Slack user ID => token
+  jiraOAuthStates = make(map[string]jiraOAuthState) // state => pending login
+)
+
+// getJiraAuthorization returns the base URL and Authorization header to call
+// Jira with on behalf of the Slack user userID: their own OAuth token if
+// they've logged in, else the bot's. The bot uses, in order of preference, a
+// personal access token (Jira Server/Data Center only, Jira Cloud doesn't
+// take them), an email and API token, or the pre-encoded auth.
+func getJiraAuthorization(userID string) (string, string, error) {
+  if token, err := getJiraOAuthToken(userID); err != nil {
+    return "", "", err
+  } else if token != nil {
+    return fmt.Sprintf(JIRA_OAUTH_API_URL, token.CloudID), fmt.Sprintf("Bearer %s", token.AccessToken), nil
+  }
+
+  switch {
+  case jiraConfig.PAT != "" && !isJiraCloud():
+    return jiraConfig.BaseURL, fmt.Sprintf("Bearer %s", jiraConfig.PAT), nil
+  case jiraConfig.Email != "" && jiraConfig.APIToken != "":
+    return jiraConfig.BaseURL, fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(jiraConfig.Email + ":" + jiraConfig.APIToken))), nil
+  default:
+    return jiraConfig.BaseURL, fmt.Sprintf("Basic %s", jiraConfig.Auth), nil
+  }
+}
+
+// getJiraOAuthToken returns userID's token, refreshed if it's about to
+// expire, or nil if they haven't logged in. jiraOAuthMutex isn't held during
+// the refresh, so one slow refresh doesn't hold up everyone else's requests.
+func getJiraOAuthToken(userID string) (*jiraOAuthToken, error) {
+  if userID == "" {
+    return nil, nil
+  }
+  jiraOAuthMutex.Lock()
+  token, ok := jiraOAuthTokens[userID]
+  jiraOAuthMutex.Unlock()
+  if !ok {
+    return nil, nil
+  }
+  if time.Now().Add(time.Minute).Before(token.Expires) {
+    return token, nil
+  }
+
+  // Refresh tokens rotate, so only one request refreshes. The rest wait for
+  // it and pick up whatever it stored.
+  token.refreshMutex.Lock()
+  defer token.refreshMutex.Unlock()
+  jiraOAuthMutex.Lock()
+  current, ok := jiraOAuthTokens[userID]
+  jiraOAuthMutex.Unlock()
+  if !ok || current != token {
+    return current, nil
+  }
+
+  refreshed := &jiraOAuthToken{CloudID: token.CloudID}
+  err := requestJiraOAuthToken(map[string]string{
+    "grant_type": "refresh_token",
+    "refresh_token": token.RefreshToken,
+  }, refreshed)
+  jiraOAuthMutex.Lock()
+  defer jiraOAuthMutex.Unlock()
+  if err != nil {
+    // Most likely revoked, so stop trying until they log in again
+    if jiraOAuthTokens[userID] == token {
+      delete(jiraOAuthTokens, userID)
+    }
+    return nil, fmt.Errorf("refreshing Jira token for %s: %v", userID, err)
+  }
+  if refreshed.RefreshToken == "" {
+    refreshed.RefreshToken = token.RefreshToken
+  }
+  // Unless they logged out or in again in the meantime
+  if jiraOAuthTokens[userID] == token {
+    jiraOAuthTokens[userID] = refreshed
+  }
+
+  return refreshed, nil
+}
+
+func hasJiraLogin(userID string) bool {
+  jiraOAuthMutex.Lock()
+  defer jiraOAuthMutex.Unlock()
+  _, ok := jiraOAuthTokens[userID]
+
+  return ok
+}
+
+// requestJiraOAuthToken posts params, plus the client credentials, to the
+// token endpoint and decodes the response into token.
+func requestJiraOAuthToken(params map[string]string, token *jiraOAuthToken) error {
+  params["client_id"] = jiraConfig.OAuthClientID
+  params["client_secret"] = jiraConfig.OAuthClientSecret
+  data, err := json.Marshal(params)
+  if err != nil {
+    return err
+  }
+  client := &http.Client{
+    Timeout: time.Duration(JIRA_REQUEST_TIMEOUT * time.Second),
+  }
+  resp, err := client.Post(JIRA_OAUTH_TOKEN_URL, "application/json", bytes.NewBuffer(data))
+  if err != nil {
+    return err
+  }
+  defer resp.Body.Close()
+  body, err := ioutil.ReadAll(resp.Body)
+  if err != nil {
+    return err
+  }
+  if resp.StatusCode != http.StatusOK {
+    return fmt.Errorf("POST %s: %s: %s", JIRA_OAUTH_TOKEN_URL, resp.Status, body)
+  }
+  if err := json.Unmarshal(body, token); err != nil {
+    return err
+  }
+  token.Expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+  return nil
+}
+
+// getJiraOAuthResource finds the Jira site the token is for, which has to be
+// the one at jira.base_url.
+func getJiraOAuthResource(token *jiraOAuthToken) (jiraOAuthResource, error) {
+  req, err := http.NewRequest("GET", JIRA_OAUTH_RESOURCES_URL, nil)
+  if err != nil {
+    return jiraOAuthResource{}, err
+  }
+  req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+  client := &http.Client{
+    Timeout: time.Duration(JIRA_REQUEST_TIMEOUT * time.Second),
+  }
+  resp, err := client.Do(req)
+  if err != nil {
+    return jiraOAuthResource{}, err
+  }
+  defer resp.Body.Close()
+  var resources []jiraOAuthResource
+  if err := json.NewDecoder(resp.Body).Decode(&resources); err != nil {
+    return jiraOAuthResource{}, err
+  }
+  for _, resource := range resources {
+    if strings.TrimRight(resource.URL, "/") == strings.TrimRight(jiraConfig.BaseURL, "/") {
+      return resource, nil
+    }
+  }
+
+  return jiraOAuthResource{}, fmt.Errorf("the token doesn't grant access to %s", jiraConfig.BaseURL)
+}
+
+// loginToJira handles ?jira login, DMing the user a link to authorize the
+// bot. It's a DM because whoever follows the link is who the bot will act as.
+func loginToJira(bot *slackbot.Bot, msg slackbot.Message) {
+  if jiraConfig.OAuthClientID == "" || jiraConfig.OAuthRedirectURL == "" {
+    bot.Reply(msg.ChannelID, TPL_JIRA_OAUTH_NOT_CONFIGURED)
+    return
+  }
+  nonce := make([]byte, 16)
+  if _, err := rand.Read(nonce); err != nil {
+    replyError(bot, msg.ChannelID, err, "starting a Jira login")
+    return
+  }
+  state := hex.EncodeToString(nonce)
+  _, _, imChannelID, err := bot.API().OpenIMChannel(msg.UserID)
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "sending you a Jira login link")
+    return
+  }
+
+  jiraOAuthMutex.Lock()
+  for s, pending := range jiraOAuthStates {
+    if time.Now().After(pending.Expires) {
+      delete(jiraOAuthStates, s)
+    }
+  }
+  jiraOAuthStates[state] = jiraOAuthState{UserID: msg.UserID, Expires: time.Now().Add(JIRA_OAUTH_STATE_TTL)}
+  jiraOAuthMutex.Unlock()
+
+  params := url.Values{}
+  params.Set("audience", "api.atlassian.com")
+  params.Set("client_id", jiraConfig.OAuthClientID)
+  params.Set("scope", JIRA_OAUTH_SCOPES)
+  params.Set("redirect_uri", jiraConfig.OAuthRedirectURL)
+  params.Set("state", state)
+  params.Set("response_type", "code")
+  params.Set("prompt", "consent")
+  bot.Reply(imChannelID, fmt.Sprintf(TPL_JIRA_LOGIN, JIRA_OAUTH_AUTHORIZE_URL + "?" + params.Encode()))
+  if imChannelID != msg.ChannelID {
+    bot.Reply(msg.ChannelID, TPL_JIRA_LOGIN_SENT)
+  }
+}
+
+// logoutOfJira handles ?jira logout.
+func logoutOfJira(bot *slackbot.Bot, msg slackbot.Message) {
+  jiraOAuthMutex.Lock()
+  delete(jiraOAuthTokens, msg.UserID)
+  jiraOAuthMutex.Unlock()
+  bot.Reply(msg.ChannelID, TPL_JIRA_LOGGED_OUT)
+}
+
+// JiraOAuthCallback returns the handler for the OAuth redirect URL, which
+// finishes a ?jira login and lets the user know in Slack.
+func JiraOAuthCallback(bot *slackbot.Bot) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    state := r.URL.Query().Get("state")
+    jiraOAuthMutex.Lock()
+    pending, ok := jiraOAuthStates[state]
+    delete(jiraOAuthStates, state)
+    jiraOAuthMutex.Unlock()
+    if !ok || time.Now().After(pending.Expires) {
+      http.Error(w, "This login link has expired, say ?jira login in Slack to get a new one", http.StatusBadRequest)
+      return
+    }
+    if r.URL.Query().Get("error") != "" {
+      http.Error(w, "Jira login was cancelled", http.StatusBadRequest)
+      return
+    }
+
+    token := &jiraOAuthToken{}
+    err := requestJiraOAuthToken(map[string]string{
+      "grant_type": "authorization_code",
+      "code": r.URL.Query().Get("code"),
+      "redirect_uri": jiraConfig.OAuthRedirectURL,
+    }, token)
+    if err != nil {
+      log.Printf("Error finishing Jira login for %s: %v", pending.UserID, err)
+      http.Error(w, "Couldn't log you in to Jira", http.StatusBadGateway)
+      return
+    }
+    resource, err := getJiraOAuthResource(token)
+    if err != nil {
+      log.Printf("Error finishing Jira login for %s: %v", pending.UserID, err)
+      http.Error(w, "Couldn't log you in to Jira", http.StatusBadGateway)
+      return
+    }
+    token.CloudID = resource.ID
+
+    jiraOAuthMutex.Lock()
+    jiraOAuthTokens[pending.UserID] = token
+    jiraOAuthMutex.Unlock()
+    log.Printf("%s logged in to Jira", bot.Users()[pending.UserID])
+    fmt.Fprintln(w, "You're logged in to Jira, you can close this window")
+    if _, _, imChannelID, err := bot.API().OpenIMChannel(pending.UserID); err == nil {
+      bot.Reply(imChannelID, fmt.Sprintf(TPL_JIRA_LOGGED_IN, resource.Name))
+    }
+  }
+}
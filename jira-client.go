@@ -0,0 +1,114 @@
+package slackbots
+
+import(
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "log"
+  "net/http"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const TPL_JIRA_ERROR_REPLY = "Jira wasn't happy %s: %s"
+
+// JiraError is the body Jira sends with a 4xx, e.g. for a bad JQL query or a
+// field it won't accept on create.
+type JiraError struct {
+  StatusCode int `json:"-"`
+  ErrorMessages []string `json:"errorMessages"`
+  Errors map[string]string `json:"errors"` // field => message
+}
+
+func (e *JiraError) Error() string {
+  messages := append([]string{}, e.ErrorMessages...)
+  var fields []string
+  for field := range e.Errors {
+    fields = append(fields, field)
+  }
+  sort.Strings(fields)
+  for _, field := range fields {
+    messages = append(messages, fmt.Sprintf("%s: %s", field, e.Errors[field]))
+  }
+
+  return strings.Join(messages, "; ")
+}
+
+// jiraRequest calls the Jira REST API at path (e.g. /rest/api/2/search) as
+// the bot, sending body as JSON when it isn't nil and decoding the response
+// into out when it isn't nil.
+func jiraRequest(method string, path string, body interface{}, out interface{}) error {
+  return jiraRequestAs("", method, path, body, out)
+}
+
+// jiraRequestAs is jiraRequest on behalf of the Slack user userID, using
+// their Jira login if they have one.
+func jiraRequestAs(userID string, method string, path string, body interface{}, out interface{}) error {
+  baseUrl, authorization, err := getJiraAuthorization(userID)
+  if err != nil {
+    return err
+  }
+  var reqBody io.Reader
+  if body != nil {
+    data, err := json.Marshal(body)
+    if err != nil {
+      return err
+    }
+    reqBody = bytes.NewBuffer(data)
+  }
+  req, err := http.NewRequest(method, baseUrl + path, reqBody)
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Content-Type", "application/json")
+  req.Header.Set("Authorization", authorization)
+
+  client := &http.Client{
+    Timeout: time.Duration(JIRA_REQUEST_TIMEOUT * time.Second),
+  }
+  resp, err := client.Do(req)
+  if err != nil {
+    return err
+  }
+  defer resp.Body.Close()
+
+  respBody, err := ioutil.ReadAll(resp.Body)
+  if err != nil {
+    return err
+  }
+  if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+    jiraErr := &JiraError{StatusCode: resp.StatusCode}
+    if err := json.Unmarshal(respBody, jiraErr); err == nil && (len(jiraErr.ErrorMessages) > 0 || len(jiraErr.Errors) > 0) {
+      return jiraErr
+    }
+    return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, respBody)
+  }
+  if out == nil || len(respBody) == 0 {
+    return nil
+  }
+
+  return json.Unmarshal(respBody, out)
+}
+
+// replyJiraError is replyError, except that when Jira explains what was wrong
+// with the request, the explanation goes back to the channel.
+func replyJiraError(bot *slackbot.Bot, channelID string, err error, action string, args ...interface{}) {
+  bot.Reply(channelID, getJiraErrorReply(err, action, args...))
+}
+
+// getJiraErrorReply is getErrorReply for replyJiraError.
+func getJiraErrorReply(err error, action string, args ...interface{}) string {
+  jiraErr, ok := err.(*JiraError)
+  if !ok {
+    return getErrorReply(err, action, args...)
+  }
+  action = fmt.Sprintf(action, args...)
+  log.Printf("Error %s: %d %v", action, jiraErr.StatusCode, jiraErr)
+
+  return fmt.Sprintf(TPL_JIRA_ERROR_REPLY, action, jiraErr)
+}
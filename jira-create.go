@@ -4,101 +4,333 @@ import(
   "bytes"
   "encoding/json"
   "fmt"
-  "io/ioutil"
   "log"
-  "net/http"
   "regexp"
   "strings"
   "time"
 
-  "github.com/premshree/lib-slackbot"
-  "github.com/spf13/viper"
+  "github.com/premshree/slackbots/slackbot"
 )
 
 type JiraResponse struct {
+  ID string `json:"id"`
   Key string `json:"key"`
+  Self string `json:"self"`
+}
+
+// JiraCreateRequest is the body of POST /rest/api/2/issue.
+type JiraCreateRequest struct {
+  Fields JiraCreateFields `json:"fields"`
+}
+
+type JiraCreateFields struct {
+  Project JiraProject `json:"project"`
+  Summary string `json:"summary"`
+  Description string `json:"description,omitempty"`
+  IssueType JiraNamed `json:"issuetype"`
+  Assignee *JiraUser `json:"assignee,omitempty"`
+  Priority *JiraNamed `json:"priority,omitempty"`
+  Labels []string `json:"labels,omitempty"`
+  Components []JiraNamed `json:"components,omitempty"`
+  Reporter *JiraUser `json:"reporter,omitempty"`
+  Custom map[string]interface{} `json:"-"` // custom field ID => value
+}
+
+// MarshalJSON adds the custom fields alongside the standard ones.
+func (f JiraCreateFields) MarshalJSON() ([]byte, error) {
+  type fields JiraCreateFields // without this method
+  data, err := json.Marshal(fields(f))
+  if err != nil || len(f.Custom) == 0 {
+    return data, err
+  }
+  merged := make(map[string]interface{})
+  if err := json.Unmarshal(data, &merged); err != nil {
+    return nil, err
+  }
+  for id, value := range f.Custom {
+    merged[id] = value
+  }
+
+  return json.Marshal(merged)
+}
+
+type JiraProject struct {
+  Key string `json:"key"`
+}
+
+type jiraCreateOptions struct {
+  IssueType string
+  Priority string
+  Labels []string
+  Components []string
+  Description string
 }
 
 const (
-  JIRA_CREATE_PATTERN = "(^[\\w]+)[\\s]+([\\w\\W\\s]+)[\\s]+<@([A-Z0-9]+)>$"
-  JIRA_ENV_PREFIX = "JIRA_CREATE"
+  // KEY summary [@assignee|@me|assignee:me]. A bare "me" is left in the
+  // summary, since "Login fails for me" isn't asking to be assigned.
+  JIRA_CREATE_PATTERN = "(^[\\w]+)[\\s]+([\\w\\W\\s]+?)(?:[\\s]+(?:<@([A-Z0-9]+)(?:\\|[^>]*)?>|((?i:@me|assignee:me))))?$"
+  JIRA_OPTION_PATTERN = "(?i)\\b(type|priority|label|component):(\"[^\"]+\"|“[^”]+”|[^\\s]+)"
+  JIRA_DESC_PATTERN = "(?is)\\bdesc:(.*?)(?:\\s+(?:<@[A-Z0-9]+(?:\\|[^>]*)?>|@me|assignee:me))?$"
+  JIRA_DEFAULT_ISSUE_TYPE = "Bug"
+  JIRA_REPORTER_FIELD = "reporter"
+  TPL_JIRA_REQUESTED_BY = "@%s in Slack"
+  TPL_JIRA_DESCRIPTION_REQUESTED_BY = "%s\n\nRequested by %s"
   JIRA_REQUEST_TIMEOUT = 3 // seconds
-  USAGE = "?jiracreate YOURPROJECT summary @asignee"
+  JIRA_THREAD_MAX_LENGTH = 30000 // Jira caps descriptions at 32767 characters
+  SLACK_USER_MENTION_PATTERN = "<@([A-Z0-9]+)(\\|[^>]*)?>"
+  USAGE = "?jiracreate YOURPROJECT summary [type:Task] [priority:High] [label:x] [component:\"Web UI\"] [@asignee|@me] [desc: details]"
 )
 
-var (
-  jiraAuth string // Uses basic auth: base64(username:password)
-  jiraBaseUrl string
-)
+type JiraConfig struct {
+  BaseURL string `mapstructure:"base_url"` // e.g. https://example.atlassian.net
+  Auth string `mapstructure:"auth"` // Pre-encoded basic auth, base64(username:password), if there's no API token or PAT
+  Email string `mapstructure:"email"` // with api_token, for Jira Cloud
+  APIToken string `mapstructure:"api_token"`
+  PAT string `mapstructure:"pat"` // personal access token, for Jira Server/Data Center
+  OAuthClientID string `mapstructure:"oauth_client_id"` // optional, for ?jira login
+  OAuthClientSecret string `mapstructure:"oauth_client_secret"`
+  OAuthRedirectURL string `mapstructure:"oauth_redirect_url"` // e.g. https://omnibot.example.com/jira/oauth
+  Channels []JiraChannelConfig `mapstructure:"channels"`
+  Projects map[string]JiraProjectConfig `mapstructure:"projects"` // project key => ?jiracreate defaults
+  UnfurlProjects []string `mapstructure:"unfurl_projects"` // project keys to unfurl, e.g. OPS
+  UnfurlCooldown time.Duration `mapstructure:"unfurl_cooldown"` // e.g. 30m, the default
+  Users []JiraUserConfig `mapstructure:"users"` // Jira accounts for Slack users whose emails don't match
+}
+
+// Enabled reports whether any of Jira is configured, in which case it all has
+// to be.
+func (cfg JiraConfig) Enabled() bool {
+  return cfg.BaseURL != "" || cfg.Auth != "" || cfg.Email != "" || cfg.APIToken != "" || cfg.PAT != "" || cfg.OAuthClientID != "" ||
+    len(cfg.Channels) > 0 || len(cfg.Projects) > 0 || len(cfg.UnfurlProjects) > 0
+}
 
-func init() {
-  viper := viper.New()
-  viper.SetEnvPrefix(JIRA_ENV_PREFIX)
-  viper.AutomaticEnv()
-  jiraAuth = viper.GetString("AUTH")
-  jiraBaseUrl = viper.GetString("BASE_URL")
+type JiraChannelConfig struct {
+  Name string `mapstructure:"name"`
+  ID string `mapstructure:"id"`
+  Filters map[string]string `mapstructure:"filters"` // filter name => JQL, for ?jira filter
 }
 
-func JiraCreate(bot *slackbot.Bot, channelID string, channelName string, args ...string) {
-  url := fmt.Sprintf("%s/rest/api/2/issue", jiraBaseUrl)
+type JiraProjectConfig struct {
+  IssueType string `mapstructure:"issue_type"`
+  Priority string `mapstructure:"priority"`
+  Labels []string `mapstructure:"labels"`
+  Components []string `mapstructure:"components"`
+  // Where to record who asked for the issue: reporter, or a custom field ID
+  // like customfield_10050 to get their Slack username. Unset means Jira
+  // decides: them if they've done ?jira login, else the bot, and then their
+  // Slack username goes at the end of the description.
+  ReporterField string `mapstructure:"reporter_field"`
+}
+
+var jiraConfig JiraConfig
+
+func configureJira(cfg JiraConfig) {
+  cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+  jiraConfig = cfg
+}
+
+// JiraCreate creates an issue. Inside a thread, the thread's messages and a
+// link back to it go into the description, and the reply goes to the thread.
+func JiraCreate(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
   if args == nil {
-    bot.Reply(channelID, fmt.Sprintf("Usage: %s", USAGE))
+    replyToMessage(bot, msg, fmt.Sprintf("Usage: %s", USAGE))
     return
   }
 
-  argsString := strings.Join(args, " ")
+  argsString, opts := parseJiraCreateOptions(strings.Join(args, " "))
   r := regexp.MustCompile(JIRA_CREATE_PATTERN)
   if !r.MatchString(argsString) {
-    bot.Reply(channelID, fmt.Sprintf("Usage: %s", USAGE))
+    replyToMessage(bot, msg, fmt.Sprintf("Usage: %s", USAGE))
     return
   }
   matches := r.FindAllStringSubmatch(argsString, -1)
-  var key, summary, asignee string
+  var key, summary, asigneeID string
   key = strings.ToUpper(matches[0][1])
   summary = matches[0][2]
-  asignee = bot.Users()[matches[0][3]]
-
-  jsonTpl := `{
-    "fields": {
-      "project":
-      {
-        "key": "%s"
-      },
-      "summary": "%s",
-      "description": "%s",
-      "issuetype": {
-        "name": "Bug"
-      },
-      "assignee": {
-        "name": "%s"
-      }
-    }
-  }`
+  asigneeID = matches[0][3]
+  if matches[0][4] != "" {
+    asigneeID = msg.UserID
+  }
+  opts = withJiraProjectDefaults(key, opts)
+  if opts.Description == "" {
+    opts.Description = summary
+  }
+  if msg.ThreadTimestamp != "" {
+    opts.Description += getJiraThreadDescription(bot, msg)
+  }
 
-  jsonStr := []byte(fmt.Sprintf(jsonTpl, key, summary, summary, asignee))
-  req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
-  req.Header.Set("Content-Type", "application/json")
-  req.Header.Set("Authorization", fmt.Sprintf("Basic %s", jiraAuth))
+  // If the createmeta can't be read, let Jira judge the create itself.
+  opts, err := validateJiraCreateOptions(key, opts)
+  if _, ok := err.(jiraValidationError); ok {
+    replyToMessage(bot, msg, fmt.Sprintf("Uh oh, %v", err))
+    return
+  } else if err != nil {
+    log.Printf("Error checking the fields of %s, creating the issue anyway: %v", key, err)
+  }
 
-  client := &http.Client{
-    Timeout: time.Duration(JIRA_REQUEST_TIMEOUT * time.Second),
+  req := JiraCreateRequest{
+    Fields: JiraCreateFields{
+      Project: JiraProject{Key: key},
+      Summary: summary,
+      Description: opts.Description,
+      IssueType: JiraNamed{Name: opts.IssueType},
+      Labels: opts.Labels,
+    },
   }
-  resp, err := client.Do(req)
-  if err != nil {
-    log.Printf("Error creating Jira ticket: %v", err)
-    bot.Reply(channelID, fmt.Sprintf("Error connecting to %s", url))
-    return
+  // Without an assignee, Jira uses the project's default or leaves it unassigned
+  if asigneeID != "" {
+    asignee, err := getJiraUser(bot, asigneeID)
+    if err != nil {
+      replyToMessage(bot, msg, getJiraUserErrorReply(bot, err, asigneeID))
+      return
+    }
+    req.Fields.Assignee = &asignee
+  }
+  switch reporterField := jiraConfig.Projects[strings.ToLower(key)].ReporterField; reporterField {
+  case "":
+    if !hasJiraLogin(msg.UserID) {
+      req.Fields.Description = fmt.Sprintf(TPL_JIRA_DESCRIPTION_REQUESTED_BY, req.Fields.Description, fmt.Sprintf(TPL_JIRA_REQUESTED_BY, bot.Users()[msg.UserID]))
+    }
+  case JIRA_REPORTER_FIELD:
+    reporter, err := getJiraUser(bot, msg.UserID)
+    if err != nil {
+      replyToMessage(bot, msg, getJiraUserErrorReply(bot, err, msg.UserID))
+      return
+    }
+    req.Fields.Reporter = &reporter
+  default:
+    req.Fields.Custom = map[string]interface{}{
+      reporterField: fmt.Sprintf(TPL_JIRA_REQUESTED_BY, bot.Users()[msg.UserID]),
+    }
+  }
+  if opts.Priority != "" {
+    req.Fields.Priority = &JiraNamed{Name: opts.Priority}
+  }
+  for _, component := range opts.Components {
+    req.Fields.Components = append(req.Fields.Components, JiraNamed{Name: component})
   }
-  defer resp.Body.Close()
 
-  body, _ := ioutil.ReadAll(resp.Body)
   var ret JiraResponse
-  if err := json.Unmarshal(body, &ret); err != nil {
-    log.Printf("Error unmarshaling json: %f", err)
+  if err := jiraRequestAs(msg.UserID, "POST", "/rest/api/2/issue", req, &ret); err != nil {
+    replyToMessage(bot, msg, getJiraErrorReply(err, "creating a Jira ticket in %s", key))
+    return
   }
   if ret.Key == "" {
-    bot.Reply(channelID, fmt.Sprintf("Usage: %s", USAGE))
+    replyToMessage(bot, msg, getErrorReply(fmt.Errorf("no issue key in the response"), "creating a Jira ticket in %s", key))
     return
   }
-  bot.Reply(channelID, fmt.Sprintf("Issue created: %s/browse/%s", jiraBaseUrl, ret.Key))
+  replyToMessage(bot, msg, fmt.Sprintf("Issue created: %s/browse/%s", jiraConfig.BaseURL, ret.Key))
+}
+
+// getJiraThreadDescription returns a link to msg's thread and a transcript
+// of it, less the ?jiracreate itself, to append to the description. If the
+// thread can't be fetched the issue is still created, just without it.
+func getJiraThreadDescription(bot *slackbot.Bot, msg slackbot.Message) string {
+  var buffer bytes.Buffer
+  permalink, err := bot.Permalink(msg.ChannelID, msg.ThreadTimestamp)
+  if err != nil {
+    log.Printf("Error getting a permalink to thread %s in #%s: %v", msg.ThreadTimestamp, msg.ChannelName, err)
+  } else {
+    buffer.WriteString(fmt.Sprintf("\n\nSlack thread: %s", permalink))
+  }
+
+  replies, err := bot.ThreadReplies(msg.ChannelID, msg.ThreadTimestamp)
+  if err != nil {
+    log.Printf("Error fetching thread %s in #%s: %v", msg.ThreadTimestamp, msg.ChannelName, err)
+    return buffer.String()
+  }
+  buffer.WriteString("\n\n{quote}\n")
+  for _, reply := range replies {
+    if reply.Timestamp == msg.Timestamp {
+      continue
+    }
+    text := replaceSlackMentions(bot, reply.Text)
+    name := bot.Users()[reply.User]
+    if name == "" {
+      name = reply.Username
+    }
+    line := fmt.Sprintf("*%s*: %s\n", name, text)
+    if buffer.Len() + len(line) > JIRA_THREAD_MAX_LENGTH {
+      buffer.WriteString("…\n")
+      break
+    }
+    buffer.WriteString(line)
+  }
+  buffer.WriteString("{quote}")
+
+  return buffer.String()
+}
+
+// replaceSlackMentions turns <@U123> into @username, which reads better
+// outside Slack.
+func replaceSlackMentions(bot *slackbot.Bot, text string) string {
+  mention := regexp.MustCompile(SLACK_USER_MENTION_PATTERN)
+
+  return mention.ReplaceAllStringFunc(text, func(m string) string {
+    return "@" + bot.Users()[mention.FindStringSubmatch(m)[1]]
+  })
+}
+
+// replyToMessage replies in msg's thread if it's in one, else in the channel.
+func replyToMessage(bot *slackbot.Bot, msg slackbot.Message, reply string) {
+  if msg.ThreadTimestamp != "" {
+    bot.ReplyInThread(msg.ChannelID, msg.ThreadTimestamp, reply)
+    return
+  }
+  bot.Reply(msg.ChannelID, reply)
+}
+
+// parseJiraCreateOptions pulls the optional type:, priority:, label:,
+// component: and desc: tokens out of a ?jiracreate command, returning what's
+// left for JIRA_CREATE_PATTERN. Values with spaces can be quoted, e.g.
+// component:"Web UI". desc: takes everything after it, up to a trailing
+// @assignee, @me or assignee:me.
+func parseJiraCreateOptions(argsString string) (string, jiraCreateOptions) {
+  var opts jiraCreateOptions
+  if loc := regexp.MustCompile(JIRA_DESC_PATTERN).FindStringSubmatchIndex(argsString); loc != nil {
+    opts.Description = strings.TrimSpace(argsString[loc[2]:loc[3]])
+    argsString = argsString[:loc[0]] + argsString[loc[3]:]
+  }
+
+  r := regexp.MustCompile(JIRA_OPTION_PATTERN)
+  for _, match := range r.FindAllStringSubmatch(argsString, -1) {
+    value := strings.Trim(match[2], "\"“”")
+    switch strings.ToLower(match[1]) {
+    case "type":
+      opts.IssueType = value
+    case "priority":
+      opts.Priority = value
+    case "label":
+      opts.Labels = append(opts.Labels, value)
+    case "component":
+      opts.Components = append(opts.Components, value)
+    }
+  }
+  argsString = r.ReplaceAllString(argsString, "")
+
+  return strings.Join(strings.Fields(argsString), " "), opts
+}
+
+// withJiraProjectDefaults fills in anything the command didn't set from the
+// project's defaults in the config, then from JIRA_DEFAULT_ISSUE_TYPE.
+func withJiraProjectDefaults(key string, opts jiraCreateOptions) jiraCreateOptions {
+  defaults := jiraConfig.Projects[strings.ToLower(key)]
+  if opts.IssueType == "" {
+    opts.IssueType = defaults.IssueType
+  }
+  if opts.IssueType == "" {
+    opts.IssueType = JIRA_DEFAULT_ISSUE_TYPE
+  }
+  if opts.Priority == "" {
+    opts.Priority = defaults.Priority
+  }
+  if opts.Labels == nil {
+    opts.Labels = defaults.Labels
+  }
+  if opts.Components == nil {
+    opts.Components = defaults.Components
+  }
+
+  return opts
 }
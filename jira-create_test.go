@@ -0,0 +1,121 @@
+package slackbots
+
+import(
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+// newFakeJira stands in for Jira: OPS has Bug and Task issue types, and
+// creates get status and body back. Created issues are sent to created.
+func newFakeJira(status int, body string, created chan<- JiraCreateFields) *httptest.Server {
+  return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case "/rest/api/2/issue/createmeta/OPS/issuetypes":
+      fmt.Fprint(w, `{"values":[{"id":"1","name":"Bug"},{"id":"3","name":"Task"}],"total":2,"isLast":true}`)
+    case "/rest/api/2/issue":
+      var req struct {
+        Fields JiraCreateFields `json:"fields"`
+      }
+      if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+      }
+      created <- req.Fields
+      w.WriteHeader(status)
+      fmt.Fprint(w, body)
+    default:
+      http.NotFound(w, r)
+    }
+  }))
+}
+
+func TestJiraCreate(t *testing.T) {
+  tests := []struct {
+    name string
+    text string
+    status int
+    body string
+    summary string
+    reply string
+  }{
+    {
+      name: "quotes",
+      text: `OPS Login says "invalid token"`,
+      status: http.StatusCreated,
+      body: `{"id":"10001","key":"OPS-1"}`,
+      summary: `Login says "invalid token"`,
+      reply: "Issue created: %s/browse/OPS-1",
+    },
+    {
+      name: "backslashes",
+      text: `OPS Can't open C:\Users\tester\notes.txt`,
+      status: http.StatusCreated,
+      body: `{"id":"10002","key":"OPS-2"}`,
+      summary: `Can't open C:\Users\tester\notes.txt`,
+      reply: "Issue created: %s/browse/OPS-2",
+    },
+    {
+      // Jira won't take a summary with a newline in it
+      name: "newlines",
+      text: "OPS Deploys fail\nafter the upgrade",
+      status: http.StatusCreated,
+      body: `{"id":"10003","key":"OPS-3"}`,
+      summary: "Deploys fail after the upgrade",
+      reply: "Issue created: %s/browse/OPS-3",
+    },
+    {
+      name: "rejected",
+      text: "OPS Deploys fail",
+      status: http.StatusBadRequest,
+      body: `{"errorMessages":["Project OPS is archived"],"errors":{"summary":"Summary is too long","components":"Component is required"}}`,
+      summary: "Deploys fail",
+      reply: "Jira wasn't happy creating a Jira ticket in OPS: Project OPS is archived; components: Component is required; summary: Summary is too long",
+    },
+    {
+      name: "no key",
+      text: "OPS Deploys fail",
+      status: http.StatusCreated,
+      body: `{}`,
+      summary: "Deploys fail",
+      reply: "Sorry, I ran into a problem creating a Jira ticket in OPS :disappointed:",
+    },
+  }
+
+  defer configureJira(jiraConfig)
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      created := make(chan JiraCreateFields, 1)
+      jira := newFakeJira(test.status, test.body, created)
+      defer jira.Close()
+      configureJira(JiraConfig{BaseURL: jira.URL, PAT: "test-pat"})
+
+      msg := slackbot.Message{ChannelID: "C0TEST", UserID: TEST_USER_ID, Text: "?jiracreate " + test.text}
+      JiraCreate(bot, msg, strings.Split(test.text, " ")...)
+
+      select {
+      case fields := <-created:
+        if fields.Summary != test.summary {
+          t.Errorf("summary = %q, want %q", fields.Summary, test.summary)
+        }
+        if requestedBy := "\n\nRequested by @tester in Slack"; !strings.HasSuffix(fields.Description, requestedBy) {
+          t.Errorf("description = %q, want it to end with %q", fields.Description, requestedBy)
+        }
+      default:
+        t.Errorf("no issue was created")
+      }
+      reply := test.reply
+      if strings.Contains(reply, "%s") {
+        reply = fmt.Sprintf(reply, jira.URL)
+      }
+      slack.expectReply(t, reply)
+    })
+  }
+}
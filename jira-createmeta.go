@@ -0,0 +1,223 @@
+package slackbots
+
+import(
+  "fmt"
+  "net/http"
+  "strings"
+  "sync"
+  "time"
+)
+
+const (
+  JIRA_CREATEMETA_TTL = time.Hour
+  JIRA_CREATEMETA_PAGE_SIZE = 100
+)
+
+// JiraCreateMetaIssueTypes is a page of /issue/createmeta/{project}/issuetypes.
+// Jira Server/Data Center returns values, Jira Cloud returns issueTypes.
+type JiraCreateMetaIssueTypes struct {
+  Values []JiraCreateMetaIssueType `json:"values"`
+  IssueTypes []JiraCreateMetaIssueType `json:"issueTypes"`
+  Total int `json:"total"`
+  IsLast bool `json:"isLast"`
+}
+
+type JiraCreateMetaIssueType struct {
+  ID string `json:"id"`
+  Name string `json:"name"`
+}
+
+// JiraCreateMetaFields is a page of
+// /issue/createmeta/{project}/issuetypes/{id}. Jira Server/Data Center
+// returns values, Jira Cloud returns fields.
+type JiraCreateMetaFields struct {
+  Values []JiraCreateMetaField `json:"values"`
+  Fields []JiraCreateMetaField `json:"fields"`
+  Total int `json:"total"`
+  IsLast bool `json:"isLast"`
+}
+
+type JiraCreateMetaField struct {
+  FieldID string `json:"fieldId"`
+  Name string `json:"name"`
+  AllowedValues []JiraNamed `json:"allowedValues"`
+}
+
+type jiraCreateMetaEntry struct {
+  IssueTypes []JiraCreateMetaIssueType
+  Fields map[string]map[string]JiraCreateMetaField // issue type ID => field ID => field
+  Expires time.Time
+}
+
+var (
+  jiraCreateMetaMutex sync.Mutex
+  jiraCreateMeta = make(map[string]jiraCreateMetaEntry) // project key => createmeta
+)
+
+// jiraValidationError is a problem with what the user asked for, as opposed to
+// a problem talking to Jira, so it's safe to show as-is.
+type jiraValidationError string
+
+func (e jiraValidationError) Error() string {
+  return string(e)
+}
+
+// validateJiraCreateOptions checks the issue type, priority, labels and
+// components against the project's createmeta, so a typo gets a useful
+// answer instead of a rejected create. Names are matched case-insensitively
+// and returned as Jira spells them. Any error that isn't a
+// jiraValidationError means the createmeta couldn't be read.
+func validateJiraCreateOptions(key string, opts jiraCreateOptions) (jiraCreateOptions, error) {
+  issueTypes, err := getJiraCreateMetaIssueTypes(key)
+  if err != nil {
+    if jiraErr, ok := err.(*JiraError); ok && jiraErr.StatusCode == http.StatusNotFound {
+      return opts, jiraValidationError(fmt.Sprintf("there's no Jira project %s, or I can't create issues in it", key))
+    }
+    return opts, err
+  }
+
+  var issueType *JiraCreateMetaIssueType
+  var issueTypeNames []string
+  for i := range issueTypes {
+    issueTypeNames = append(issueTypeNames, issueTypes[i].Name)
+    if strings.EqualFold(issueTypes[i].Name, opts.IssueType) {
+      issueType = &issueTypes[i]
+    }
+  }
+  if issueType == nil {
+    return opts, jiraValidationError(fmt.Sprintf("%s is not an issue type in %s. Try one of: %s", opts.IssueType, key, strings.Join(issueTypeNames, ", ")))
+  }
+  opts.IssueType = issueType.Name
+  if opts.Priority == "" && len(opts.Labels) == 0 && len(opts.Components) == 0 {
+    return opts, nil
+  }
+
+  fields, err := getJiraCreateMetaFields(key, *issueType)
+  if err != nil {
+    return opts, err
+  }
+  if opts.Priority != "" {
+    priorities, err := validateJiraFieldValues(key, issueType.Name, fields, "priority", opts.Priority)
+    if err != nil {
+      return opts, err
+    }
+    opts.Priority = priorities[0]
+  }
+  if len(opts.Labels) > 0 {
+    if _, ok := fields["labels"]; !ok {
+      return opts, jiraValidationError(fmt.Sprintf("%s issues in %s can't have labels", issueType.Name, key))
+    }
+  }
+  if len(opts.Components) > 0 {
+    components, err := validateJiraFieldValues(key, issueType.Name, fields, "components", opts.Components...)
+    if err != nil {
+      return opts, err
+    }
+    opts.Components = components
+  }
+
+  return opts, nil
+}
+
+// validateJiraFieldValues checks that field is on the create screen and that
+// each value is one of its allowed values, returning the allowed names.
+func validateJiraFieldValues(key string, issueType string, fields map[string]JiraCreateMetaField, field string, values ...string) ([]string, error) {
+  metaField, ok := fields[field]
+  if !ok {
+    return nil, jiraValidationError(fmt.Sprintf("%s issues in %s don't have a %s field", issueType, key, field))
+  }
+  var allowed []string
+  for _, allowedValue := range metaField.AllowedValues {
+    allowed = append(allowed, allowedValue.Name)
+  }
+  var names []string
+  for _, value := range values {
+    found := false
+    for _, name := range allowed {
+      if strings.EqualFold(name, value) {
+        names = append(names, name)
+        found = true
+        break
+      }
+    }
+    if !found {
+      return nil, jiraValidationError(fmt.Sprintf("%s is not a valid %s for %s issues in %s. Try one of: %s", value, metaField.Name, issueType, key, strings.Join(allowed, ", ")))
+    }
+  }
+
+  return names, nil
+}
+
+// getJiraCreateMetaIssueTypes returns the issue types that can be created in
+// the project, from the cache if it was fetched in the last
+// JIRA_CREATEMETA_TTL.
+func getJiraCreateMetaIssueTypes(key string) ([]JiraCreateMetaIssueType, error) {
+  key = strings.ToUpper(key)
+  jiraCreateMetaMutex.Lock()
+  entry, ok := jiraCreateMeta[key]
+  jiraCreateMetaMutex.Unlock()
+  if ok && time.Now().Before(entry.Expires) {
+    return entry.IssueTypes, nil
+  }
+
+  var issueTypes []JiraCreateMetaIssueType
+  for {
+    var page JiraCreateMetaIssueTypes
+    path := fmt.Sprintf("/rest/api/2/issue/createmeta/%s/issuetypes?startAt=%d&maxResults=%d", key, len(issueTypes), JIRA_CREATEMETA_PAGE_SIZE)
+    if err := jiraRequest("GET", path, nil, &page); err != nil {
+      return nil, err
+    }
+    values := append(page.Values, page.IssueTypes...)
+    issueTypes = append(issueTypes, values...)
+    if len(values) == 0 || page.IsLast || len(issueTypes) >= page.Total {
+      break
+    }
+  }
+
+  jiraCreateMetaMutex.Lock()
+  jiraCreateMeta[key] = jiraCreateMetaEntry{
+    IssueTypes: issueTypes,
+    Fields: make(map[string]map[string]JiraCreateMetaField),
+    Expires: time.Now().Add(JIRA_CREATEMETA_TTL),
+  }
+  jiraCreateMetaMutex.Unlock()
+  return issueTypes, nil
+}
+
+// getJiraCreateMetaFields returns the fields on the create screen for an issue
+// type in the project, keyed by field ID. They're cached alongside the
+// project's issue types.
+func getJiraCreateMetaFields(key string, issueType JiraCreateMetaIssueType) (map[string]JiraCreateMetaField, error) {
+  key = strings.ToUpper(key)
+  jiraCreateMetaMutex.Lock()
+  entry, ok := jiraCreateMeta[key]
+  fields, cached := entry.Fields[issueType.ID]
+  jiraCreateMetaMutex.Unlock()
+  if ok && cached && time.Now().Before(entry.Expires) {
+    return fields, nil
+  }
+
+  fields = make(map[string]JiraCreateMetaField)
+  for startAt := 0; ; {
+    var page JiraCreateMetaFields
+    path := fmt.Sprintf("/rest/api/2/issue/createmeta/%s/issuetypes/%s?startAt=%d&maxResults=%d", key, issueType.ID, startAt, JIRA_CREATEMETA_PAGE_SIZE)
+    if err := jiraRequest("GET", path, nil, &page); err != nil {
+      return nil, err
+    }
+    values := append(page.Values, page.Fields...)
+    for _, field := range values {
+      fields[field.FieldID] = field
+    }
+    startAt += len(values)
+    if len(values) == 0 || page.IsLast || startAt >= page.Total {
+      break
+    }
+  }
+
+  jiraCreateMetaMutex.Lock()
+  if entry, ok := jiraCreateMeta[key]; ok && entry.Fields != nil {
+    entry.Fields[issueType.ID] = fields
+  }
+  jiraCreateMetaMutex.Unlock()
+  return fields, nil
+}
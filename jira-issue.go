@@ -0,0 +1,155 @@
+package slackbots
+
+import(
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const (
+  JIRA_KEY_PATTERN = "^[A-Z][A-Z0-9_]+-[0-9]+$"
+  TPL_JIRA_MOVED = "Moved <%s/browse/%s|%s> to %s"
+  TPL_JIRA_COMMENTED = "Commented on <%s/browse/%s|%s>"
+  TPL_JIRA_ASSIGNED = "Assigned <%s/browse/%s|%s> to %s"
+  TPL_JIRA_COMMENT = "%s\n\n— @%s in Slack"
+  TPL_JIRA_NO_TRANSITION = "Uh oh, %s can't be moved to %s. Try one of: %s"
+  TPL_JIRA_NO_TRANSITIONS = "Uh oh, %s can't be moved anywhere right now"
+)
+
+type JiraTransitionsResponse struct {
+  Transitions []JiraTransition `json:"transitions"`
+}
+
+type JiraTransition struct {
+  ID string `json:"id"`
+  Name string `json:"name"`
+  To JiraNamed `json:"to"`
+}
+
+type JiraTransitionRequest struct {
+  Transition JiraTransitionRef `json:"transition"`
+}
+
+type JiraTransitionRef struct {
+  ID string `json:"id"`
+}
+
+type JiraCommentRequest struct {
+  Body string `json:"body"`
+}
+
+// moveJiraIssue handles ?jira move KEY <status>. The status can be either the
+// transition's name (e.g. Start Progress) or the status it goes to.
+func moveJiraIssue(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  if len(args) < 2 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+  key, ok := getJiraIssueKey(args[0])
+  if !ok {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+  status := strings.Join(args[1:], " ")
+
+  var resp JiraTransitionsResponse
+  path := fmt.Sprintf("/rest/api/2/issue/%s/transitions", key)
+  if err := jiraRequestAs(msg.UserID, "GET", path, nil, &resp); err != nil {
+    replyJiraError(bot, msg.ChannelID, err, "looking up transitions for %s", key)
+    return
+  }
+  if len(resp.Transitions) == 0 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_JIRA_NO_TRANSITIONS, key))
+    return
+  }
+  transition, ok := findJiraTransition(resp.Transitions, status)
+  if !ok {
+    var names []string
+    for _, t := range resp.Transitions {
+      names = append(names, t.To.Name)
+    }
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_JIRA_NO_TRANSITION, key, status, strings.Join(names, ", ")))
+    return
+  }
+
+  req := JiraTransitionRequest{Transition: JiraTransitionRef{ID: transition.ID}}
+  if err := jiraRequestAs(msg.UserID, "POST", path, req, nil); err != nil {
+    replyJiraError(bot, msg.ChannelID, err, "moving %s to %s", key, transition.To.Name)
+    return
+  }
+  bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_JIRA_MOVED, jiraConfig.BaseURL, key, key, transition.To.Name))
+}
+
+// commentOnJiraIssue handles ?jira comment KEY <text>. Unless the user has
+// logged in, Jira sees the bot's account as the author, so the comment says
+// who wrote it.
+func commentOnJiraIssue(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  if len(args) < 2 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+  key, ok := getJiraIssueKey(args[0])
+  if !ok {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+  text := replaceSlackMentions(bot, strings.Join(args[1:], " "))
+
+  req := JiraCommentRequest{Body: text}
+  if !hasJiraLogin(msg.UserID) {
+    req.Body = fmt.Sprintf(TPL_JIRA_COMMENT, text, bot.Users()[msg.UserID])
+  }
+  if err := jiraRequestAs(msg.UserID, "POST", fmt.Sprintf("/rest/api/2/issue/%s/comment", key), req, nil); err != nil {
+    replyJiraError(bot, msg.ChannelID, err, "commenting on %s", key)
+    return
+  }
+  bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_JIRA_COMMENTED, jiraConfig.BaseURL, key, key))
+}
+
+// assignJiraIssue handles ?jira assign KEY @user.
+func assignJiraIssue(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  if len(args) != 2 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+  key, ok := getJiraIssueKey(args[0])
+  if !ok {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+  userID, ok := parseSlackMention(args[1])
+  if !ok {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+  assignee, err := getJiraUser(bot, userID)
+  if err != nil {
+    replyJiraUserError(bot, msg.ChannelID, err, userID)
+    return
+  }
+
+  name := bot.Users()[userID]
+  if err := jiraRequestAs(msg.UserID, "PUT", fmt.Sprintf("/rest/api/2/issue/%s/assignee", key), assignee, nil); err != nil {
+    replyJiraError(bot, msg.ChannelID, err, "assigning %s to %s", key, name)
+    return
+  }
+  bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_JIRA_ASSIGNED, jiraConfig.BaseURL, key, key, name))
+}
+
+func getJiraIssueKey(arg string) (string, bool) {
+  key := strings.ToUpper(arg)
+
+  return key, regexp.MustCompile(JIRA_KEY_PATTERN).MatchString(key)
+}
+
+func findJiraTransition(transitions []JiraTransition, status string) (JiraTransition, bool) {
+  for _, transition := range transitions {
+    if strings.EqualFold(transition.Name, status) || strings.EqualFold(transition.To.Name, status) {
+      return transition, true
+    }
+  }
+
+  return JiraTransition{}, false
+}
@@ -0,0 +1,212 @@
+package slackbots
+
+import(
+  "bytes"
+  "fmt"
+  "net/url"
+  "sort"
+  "strings"
+  "sync"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const (
+  JIRA_USAGE = "?jira search <JQL> | ?jira mine | ?jira filter [name] | ?jira more | ?jira move KEY <status> | ?jira comment KEY <text> | ?jira assign KEY @user | ?jira login | ?jira logout"
+  JIRA_SEARCH_PAGE_SIZE = 10
+  JIRA_MINE_JQL = "assignee = \"%s\" AND resolution = Unresolved ORDER BY updated DESC"
+  TPL_JIRA_ISSUE_LINE = "<%s/browse/%s|%s> [%s] %s (%s)\n"
+  TPL_JIRA_SEARCH_FOOTER = "Showing %d-%d of %d. Say `?jira more` for the next page."
+  TPL_JIRA_NO_ISSUES = "No issues match `%s`"
+  TPL_JIRA_NO_MORE = "Nothing more to show, start a new ?jira search"
+  TPL_JIRA_NO_FILTERS = "Uh oh, #%s has no Jira filters configured"
+  TPL_JIRA_FILTER_NOT_CONFIGURED = "Uh oh, %s is not a Jira filter for #%s. Try one of: %s"
+)
+
+type JiraSearchResponse struct {
+  StartAt int `json:"startAt"`
+  MaxResults int `json:"maxResults"`
+  Total int `json:"total"`
+  Issues []JiraIssue `json:"issues"`
+}
+
+type JiraIssue struct {
+  Key string `json:"key"`
+  Fields JiraIssueFields `json:"fields"`
+}
+
+type JiraIssueFields struct {
+  Summary string `json:"summary"`
+  Status *JiraNamed `json:"status"`
+  Priority *JiraNamed `json:"priority"`
+  Assignee *JiraUser `json:"assignee"`
+}
+
+type JiraNamed struct {
+  Name string `json:"name"`
+}
+
+type JiraUser struct {
+  AccountID string `json:"accountId,omitempty"` // Jira Cloud
+  Name string `json:"name,omitempty"` // Jira Server/Data Center
+  DisplayName string `json:"displayName,omitempty"`
+  EmailAddress string `json:"emailAddress,omitempty"`
+}
+
+// jiraSearch is a channel's last search, so ?jira more can fetch its next page.
+type jiraSearch struct {
+  JQL string
+  StartAt int
+}
+
+var (
+  jiraSearchesMutex sync.Mutex
+  jiraSearches = make(map[string]jiraSearch) // channel ID => last search
+)
+
+func Jira(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  if args == nil {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+    return
+  }
+
+  switch strings.ToLower(args[0]) {
+  case "search":
+    if len(args) < 2 {
+      bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+      return
+    }
+    searchJira(bot, msg.ChannelID, strings.Join(args[1:], " "), 0)
+  case "mine":
+    user, err := getJiraUser(bot, msg.UserID)
+    if err != nil {
+      replyJiraUserError(bot, msg.ChannelID, err, msg.UserID)
+      return
+    }
+    searchJira(bot, msg.ChannelID, fmt.Sprintf(JIRA_MINE_JQL, getJiraUserJQL(user)), 0)
+  case "filter":
+    searchJiraFilter(bot, msg, args[1:]...)
+  case "more":
+    jiraSearchesMutex.Lock()
+    search, ok := jiraSearches[msg.ChannelID]
+    jiraSearchesMutex.Unlock()
+    if !ok {
+      bot.Reply(msg.ChannelID, TPL_JIRA_NO_MORE)
+      return
+    }
+    searchJira(bot, msg.ChannelID, search.JQL, search.StartAt)
+  case "move":
+    moveJiraIssue(bot, msg, args[1:]...)
+  case "comment":
+    commentOnJiraIssue(bot, msg, args[1:]...)
+  case "assign":
+    assignJiraIssue(bot, msg, args[1:]...)
+  case "login":
+    loginToJira(bot, msg)
+  case "logout":
+    logoutOfJira(bot, msg)
+  default:
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", JIRA_USAGE))
+  }
+}
+
+// searchJiraFilter runs one of the channel's named filters, or lists them.
+func searchJiraFilter(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  channelConfig, _ := getJiraChannelConfig(msg.ChannelID, msg.ChannelName)
+  if len(channelConfig.Filters) == 0 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_JIRA_NO_FILTERS, msg.ChannelName))
+    return
+  }
+  var names []string
+  for name := range channelConfig.Filters {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  if len(args) == 0 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Jira filters for #%s: %s", msg.ChannelName, strings.Join(names, ", ")))
+    return
+  }
+  jql, ok := channelConfig.Filters[strings.ToLower(args[0])]
+  if !ok {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_JIRA_FILTER_NOT_CONFIGURED, args[0], msg.ChannelName, strings.Join(names, ", ")))
+    return
+  }
+  searchJira(bot, msg.ChannelID, jql, 0)
+}
+
+// searchJira replies with one page of issues matching jql, starting at
+// startAt, and remembers where the next page starts.
+func searchJira(bot *slackbot.Bot, channelID string, jql string, startAt int) {
+  var buffer bytes.Buffer
+  params := url.Values{}
+  params.Set("jql", jql)
+  params.Set("startAt", fmt.Sprintf("%d", startAt))
+  params.Set("maxResults", fmt.Sprintf("%d", JIRA_SEARCH_PAGE_SIZE))
+  params.Set("fields", "summary,status,assignee")
+
+  var resp JiraSearchResponse
+  if err := jiraRequest("GET", "/rest/api/2/search?" + params.Encode(), nil, &resp); err != nil {
+    replyJiraError(bot, channelID, err, "searching for `%s`", jql)
+    return
+  }
+  if len(resp.Issues) == 0 {
+    jiraSearchesMutex.Lock()
+    delete(jiraSearches, channelID)
+    jiraSearchesMutex.Unlock()
+    if startAt > 0 {
+      bot.Reply(channelID, TPL_JIRA_NO_MORE)
+    } else {
+      bot.Reply(channelID, fmt.Sprintf(TPL_JIRA_NO_ISSUES, jql))
+    }
+    return
+  }
+
+  for _, issue := range resp.Issues {
+    buffer.WriteString(formatJiraIssue(issue))
+  }
+  end := resp.StartAt + len(resp.Issues)
+  jiraSearchesMutex.Lock()
+  if end < resp.Total {
+    jiraSearches[channelID] = jiraSearch{JQL: jql, StartAt: end}
+    buffer.WriteString(fmt.Sprintf(TPL_JIRA_SEARCH_FOOTER, resp.StartAt + 1, end, resp.Total))
+  } else {
+    delete(jiraSearches, channelID)
+  }
+  jiraSearchesMutex.Unlock()
+  bot.Reply(channelID, buffer.String())
+}
+
+func formatJiraIssue(issue JiraIssue) string {
+  status := "?"
+  if issue.Fields.Status != nil {
+    status = issue.Fields.Status.Name
+  }
+
+  return fmt.Sprintf(TPL_JIRA_ISSUE_LINE, jiraConfig.BaseURL, issue.Key, issue.Key, status, issue.Fields.Summary, getJiraUserName(issue.Fields.Assignee))
+}
+
+func getJiraUserName(user *JiraUser) string {
+  if user == nil {
+    return "unassigned"
+  }
+  if user.DisplayName != "" {
+    return user.DisplayName
+  }
+
+  return user.Name
+}
+
+func getJiraChannelConfig(channelID string, channelName string) (JiraChannelConfig, bool) {
+  for _, channelConfig := range jiraConfig.Channels {
+    if channelConfig.ID != "" && channelConfig.ID == channelID {
+      return channelConfig, true
+    }
+  }
+  for _, channelConfig := range jiraConfig.Channels {
+    if channelConfig.ID == "" && channelName != "" && channelConfig.Name == channelName {
+      return channelConfig, true
+    }
+  }
+
+  return JiraChannelConfig{}, false
+}
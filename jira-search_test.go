@@ -0,0 +1,28 @@
+package slackbots
+
+import(
+  "net/http/httptest"
+  "testing"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+func TestJiraSearchFailingBackend(t *testing.T) {
+  defer configureJira(jiraConfig)
+
+  for _, backend := range failingBackends {
+    t.Run(backend.name, func(t *testing.T) {
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      jira := httptest.NewServer(backend.handler)
+      defer jira.Close()
+      configureJira(JiraConfig{BaseURL: jira.URL, PAT: "test-pat"})
+
+      msg := slackbot.Message{ChannelID: "C0TEST", UserID: TEST_USER_ID, Text: "?jira search project = OPS"}
+      runCommand(t, func() {
+        Jira(bot, msg, "search", "project", "=", "OPS")
+      })
+      slack.expectReply(t, "Sorry, I ran into a problem searching for `project = OPS` :disappointed:")
+    })
+  }
+}
@@ -0,0 +1,98 @@
+package slackbots
+
+import(
+  "fmt"
+  "log"
+  "regexp"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const (
+  JIRA_UNFURL_MAX_KEYS = 3 // per message
+  DEFAULT_JIRA_UNFURL_COOLDOWN = 30 * time.Minute
+  TPL_JIRA_UNFURL = "<%s/browse/%s|%s> %s [%s, %s] assigned to %s"
+)
+
+var (
+  jiraUnfurlsMutex sync.Mutex
+  jiraUnfurls = make(map[string]time.Time) // channel ID/issue key => last unfurled
+)
+
+// JiraUnfurl is a listener that replies with the details of Jira issues
+// mentioned in a message, e.g. OPS-1234. Only keys in the configured
+// unfurl_projects are matched, and each key is unfurled at most once per
+// channel per unfurl_cooldown.
+func JiraUnfurl(bot *slackbot.Bot, msg slackbot.Message) {
+  pattern := getJiraUnfurlPattern()
+  if pattern == nil {
+    return
+  }
+
+  keys := pattern.FindAllString(msg.Text, -1)
+  seen := make(map[string]bool)
+  for _, key := range keys {
+    if seen[key] || len(seen) == JIRA_UNFURL_MAX_KEYS {
+      continue
+    }
+    seen[key] = true
+    if !shouldUnfurl(msg.ChannelID, key) {
+      continue
+    }
+
+    var issue JiraIssue
+    path := fmt.Sprintf("/rest/api/2/issue/%s?fields=summary,status,priority,assignee", key)
+    if err := jiraRequest("GET", path, nil, &issue); err != nil {
+      // Not worth interrupting the conversation for, it may not even be an issue
+      log.Printf("Error unfurling %s in #%s: %v", key, msg.ChannelName, err)
+      continue
+    }
+    bot.Reply(msg.ChannelID, formatJiraUnfurl(issue))
+  }
+}
+
+func getJiraUnfurlPattern() *regexp.Regexp {
+  if len(jiraConfig.UnfurlProjects) == 0 {
+    return nil
+  }
+  var projects []string
+  for _, project := range jiraConfig.UnfurlProjects {
+    projects = append(projects, regexp.QuoteMeta(strings.ToUpper(project)))
+  }
+
+  return regexp.MustCompile(fmt.Sprintf("\\b(%s)-[0-9]+\\b", strings.Join(projects, "|")))
+}
+
+// shouldUnfurl reports whether key is out of its cooldown in the channel, and
+// if so starts a new one.
+func shouldUnfurl(channelID string, key string) bool {
+  cooldown := jiraConfig.UnfurlCooldown
+  if cooldown == 0 {
+    cooldown = DEFAULT_JIRA_UNFURL_COOLDOWN
+  }
+  id := channelID + "/" + key
+
+  jiraUnfurlsMutex.Lock()
+  defer jiraUnfurlsMutex.Unlock()
+  if last, ok := jiraUnfurls[id]; ok && time.Since(last) < cooldown {
+    return false
+  }
+  jiraUnfurls[id] = time.Now()
+
+  return true
+}
+
+func formatJiraUnfurl(issue JiraIssue) string {
+  status, priority := "?", "?"
+  if issue.Fields.Status != nil {
+    status = issue.Fields.Status.Name
+  }
+  if issue.Fields.Priority != nil {
+    priority = issue.Fields.Priority.Name
+  }
+
+  return fmt.Sprintf(TPL_JIRA_UNFURL, jiraConfig.BaseURL, issue.Key, issue.Key, issue.Fields.Summary, status, priority, getJiraUserName(issue.Fields.Assignee))
+}
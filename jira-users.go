@@ -0,0 +1,114 @@
+package slackbots
+
+import(
+  "fmt"
+  "net/url"
+  "strings"
+  "sync"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const JIRA_CLOUD_HOST_SUFFIX = ".atlassian.net"
+
+// JiraUserConfig maps a Slack user to a Jira account when their emails don't
+// match. Set AccountID on Jira Cloud and Name on Jira Server/Data Center.
+type JiraUserConfig struct {
+  SlackUser string `mapstructure:"slack_user"` // Slack username or user ID
+  AccountID string `mapstructure:"account_id"`
+  Name string `mapstructure:"name"`
+}
+
+var (
+  jiraUsersMutex sync.Mutex
+  jiraUsers = make(map[string]JiraUser) // Slack user ID => Jira account
+)
+
+// getJiraUser resolves a Slack user to their Jira account: from the users
+// list in the config if they're in it, else by searching Jira for the email
+// on their Slack profile. Accounts that are found are cached.
+func getJiraUser(bot *slackbot.Bot, userID string) (JiraUser, error) {
+  slackName := bot.Users()[userID]
+  for _, userConfig := range jiraConfig.Users {
+    if isSlackUser(userConfig.SlackUser, userID, slackName) {
+      return JiraUser{AccountID: userConfig.AccountID, Name: userConfig.Name}, nil
+    }
+  }
+  jiraUsersMutex.Lock()
+  user, ok := jiraUsers[userID]
+  jiraUsersMutex.Unlock()
+  if ok {
+    return user, nil
+  }
+
+  slackUser, err := bot.API().GetUserInfo(userID)
+  if err != nil {
+    return JiraUser{}, err
+  }
+  email := slackUser.Profile.Email
+  if email == "" {
+    return JiraUser{}, jiraValidationError(fmt.Sprintf("@%s has no email on their Slack profile for me to find them in Jira by", slackName))
+  }
+
+  params := url.Values{}
+  if isJiraCloud() {
+    params.Set("query", email)
+  } else {
+    params.Set("username", email)
+  }
+  var users []JiraUser
+  if err := jiraRequest("GET", "/rest/api/2/user/search?" + params.Encode(), nil, &users); err != nil {
+    return JiraUser{}, err
+  }
+  for _, u := range users {
+    // The search is a prefix match, so make sure it's really them
+    if strings.EqualFold(u.EmailAddress, email) || (len(users) == 1 && u.EmailAddress == "") {
+      user = JiraUser{AccountID: u.AccountID, Name: u.Name}
+      if !isJiraCloud() {
+        user.AccountID = ""
+      }
+      jiraUsersMutex.Lock()
+      jiraUsers[userID] = user
+      jiraUsersMutex.Unlock()
+      return user, nil
+    }
+  }
+
+  return JiraUser{}, jiraValidationError(fmt.Sprintf("I couldn't find a Jira account for @%s (%s)", slackName, email))
+}
+
+// getJiraUserJQL returns how to refer to user in JQL, e.g. assignee = "x".
+func getJiraUserJQL(user JiraUser) string {
+  if user.AccountID != "" {
+    return user.AccountID
+  }
+
+  return user.Name
+}
+
+// isJiraCloud reports whether jira.base_url is Jira Cloud, which identifies
+// users by accountId rather than username.
+func isJiraCloud() bool {
+  return isJiraCloudURL(jiraConfig.BaseURL)
+}
+
+func isJiraCloudURL(baseURL string) bool {
+  u, err := url.Parse(baseURL)
+  if err != nil {
+    return false
+  }
+
+  return strings.HasSuffix(u.Host, JIRA_CLOUD_HOST_SUFFIX)
+}
+
+func replyJiraUserError(bot *slackbot.Bot, channelID string, err error, userID string) {
+  bot.Reply(channelID, getJiraUserErrorReply(bot, err, userID))
+}
+
+func getJiraUserErrorReply(bot *slackbot.Bot, err error, userID string) string {
+  if _, ok := err.(jiraValidationError); ok {
+    return fmt.Sprintf("Uh oh, %v", err)
+  }
+
+  return getJiraErrorReply(err, "looking up @%s in Jira", bot.Users()[userID])
+}
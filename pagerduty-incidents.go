@@ -0,0 +1,234 @@
+package slackbots
+
+import(
+  "bytes"
+  "fmt"
+  "strings"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+  "github.com/PagerDuty/go-pagerduty"
+)
+
+const (
+  TPL_NO_OPEN_INCIDENTS = "No open incidents for #%s :tada:"
+  TPL_INCIDENT_LINE = "#%d [%s/%s] %s: %s (%s ago, %s) %s\n"
+  TPL_NO_PAGERDUTY_IDENTITY = "Sorry @%s, your Slack user isn't linked to a PagerDuty user, so I can't %s incidents for you"
+  TPL_INCIDENT_NOT_FOUND = "%s is not an open incident for #%s"
+  TPL_INCIDENT_UPDATED = "@%s %s #%d: %s"
+)
+
+var openIncidentStatuses = []string{"triggered", "acknowledged"}
+
+func PagerDutyIncidents(bot *slackbot.Bot, channelID string, channelName string, args ...string) {
+  var buffer bytes.Buffer
+  var channelConfig ChannelConfig
+  var ok bool
+  if channelConfig, ok = getChannelConfig(channelID, channelName); !ok {
+    bot.Reply(channelID, getChannelNotConfiguredReply(channelName))
+    return
+  }
+
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  incidents, err := listOpenIncidents(client, channelConfig)
+  if err != nil {
+    replyError(bot, channelID, err, "listing incidents for #%s", channelName)
+    return
+  }
+  if len(incidents) == 0 {
+    bot.Reply(channelID, fmt.Sprintf(TPL_NO_OPEN_INCIDENTS, channelName))
+    return
+  }
+
+  for _, incident := range incidents {
+    buffer.WriteString(fmt.Sprintf(
+      TPL_INCIDENT_LINE,
+      incident.IncidentNumber,
+      incident.Status,
+      incident.Urgency,
+      incident.Service.Summary,
+      incident.Summary,
+      getIncidentAge(incident),
+      getIncidentAssignees(incident),
+      incident.HTMLURL,
+    ))
+  }
+  bot.Reply(channelID, buffer.String())
+}
+
+func PagerDutyAck(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  manageIncident(bot, msg, "acknowledged", "ack", args...)
+}
+
+func PagerDutyResolve(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  manageIncident(bot, msg, "resolved", "resolve", args...)
+}
+
+// manageIncident moves one of the channel's open incidents to status on behalf
+// of the Slack user who sent msg. PagerDuty requires the From header to be the
+// email of a PagerDuty user, so callers without a linked identity are refused.
+func manageIncident(bot *slackbot.Bot, msg slackbot.Message, status string, verb string, args ...string) {
+  if args == nil {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: ?%s <incident number or ID>", verb))
+    return
+  }
+  var channelConfig ChannelConfig
+  var ok bool
+  if channelConfig, ok = getChannelConfig(msg.ChannelID, msg.ChannelName); !ok {
+    bot.Reply(msg.ChannelID, getChannelNotConfiguredReply(msg.ChannelName))
+    return
+  }
+  userName := bot.Users()[msg.UserID]
+  from, ok := getPagerDutyEmail(msg.UserID, userName)
+  if !ok {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_NO_PAGERDUTY_IDENTITY, userName, verb))
+    return
+  }
+
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  incidents, err := listOpenIncidents(client, channelConfig)
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "listing incidents for #%s", msg.ChannelName)
+    return
+  }
+  incident, ok := findIncident(incidents, args[0])
+  if !ok {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_INCIDENT_NOT_FOUND, args[0], msg.ChannelName))
+    return
+  }
+
+  update := pagerduty.Incident{
+    APIObject: pagerduty.APIObject{
+      ID: incident.ID,
+      Type: "incident_reference",
+    },
+    Status: status,
+  }
+  if err := client.ManageIncidents(from, []pagerduty.Incident{update}); err != nil {
+    replyError(bot, msg.ChannelID, err, "updating incident #%d", incident.IncidentNumber)
+    return
+  }
+  bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_INCIDENT_UPDATED, userName, status, incident.IncidentNumber, incident.Summary))
+}
+
+// getPagerDutyEmail returns the PagerDuty login linked to a Slack user in the
+// config's users list.
+func getPagerDutyEmail(slackUserID string, slackUserName string) (string, bool) {
+  for _, userConfig := range pagerDutyConfig.Users {
+    if isSlackUser(userConfig.SlackUser, slackUserID, slackUserName) && userConfig.Email != "" {
+      return userConfig.Email, true
+    }
+  }
+
+  return "", false
+}
+
+// findIncident matches ref against an incident's ID or its number, with or
+// without a leading #.
+func findIncident(incidents []pagerduty.Incident, ref string) (pagerduty.Incident, bool) {
+  ref = strings.TrimPrefix(ref, "#")
+  for _, incident := range incidents {
+    if incident.ID == ref || fmt.Sprintf("%d", incident.IncidentNumber) == ref {
+      return incident, true
+    }
+  }
+
+  return pagerduty.Incident{}, false
+}
+
+// listOpenIncidents returns the triggered and acknowledged incidents on the
+// services that belong to the channel.
+func listOpenIncidents(client *pagerduty.Client, channelConfig ChannelConfig) ([]pagerduty.Incident, error) {
+  serviceIDs, err := getChannelServiceIDs(client, channelConfig)
+  if err != nil {
+    return nil, err
+  }
+  if len(serviceIDs) == 0 {
+    return nil, nil
+  }
+
+  // Page through them all, since an incident storm is when it matters
+  var incidents []pagerduty.Incident
+  opts := pagerduty.ListIncidentsOptions{
+    APIListObject: pagerduty.APIListObject{Limit: PAGERDUTY_PAGE_SIZE},
+    Statuses: openIncidentStatuses,
+    ServiceIDs: serviceIDs,
+    SortBy: "created_at:desc",
+  }
+  for {
+    resp, err := client.ListIncidents(opts)
+    if err != nil {
+      return nil, err
+    }
+    incidents = append(incidents, resp.Incidents...)
+    if !resp.More || len(resp.Incidents) == 0 {
+      return incidents, nil
+    }
+    opts.Offset += uint(len(resp.Incidents))
+  }
+}
+
+// getChannelServiceIDs returns the services of every escalation policy
+// configured for the channel, plus any services configured by ID.
+func getChannelServiceIDs(client *pagerduty.Client, channelConfig ChannelConfig) ([]string, error) {
+  var serviceIDs []string
+  seen := make(map[string]bool)
+  for _, escalationPolicyID := range getEscalationPolicyIDs(channelConfig) {
+    escalationPolicy, err := client.GetEscalationPolicy(escalationPolicyID, &pagerduty.GetEscalationPolicyOptions{})
+    if err != nil {
+      return nil, err
+    }
+    for _, service := range escalationPolicy.Services {
+      if !seen[service.ID] {
+        seen[service.ID] = true
+        serviceIDs = append(serviceIDs, service.ID)
+      }
+    }
+  }
+  for _, service := range channelConfig.Services {
+    if service.ID != "" && !seen[service.ID] {
+      seen[service.ID] = true
+      serviceIDs = append(serviceIDs, service.ID)
+    }
+  }
+
+  return serviceIDs, nil
+}
+
+func getIncidentAge(incident pagerduty.Incident) string {
+  createdAt, err := time.Parse(time.RFC3339, incident.CreatedAt)
+  if err != nil {
+    return "?"
+  }
+
+  return formatDuration(time.Since(createdAt))
+}
+
+func getIncidentAssignees(incident pagerduty.Incident) string {
+  if len(incident.Assignments) == 0 {
+    return "unassigned"
+  }
+  var buffer bytes.Buffer
+  for i, assignment := range incident.Assignments {
+    if i > 0 {
+      buffer.WriteString(", ")
+    }
+    buffer.WriteString(assignment.Assignee.Summary)
+  }
+
+  return buffer.String()
+}
+
+// formatDuration renders a duration the way people say it in chat: 3d, 5h, 12m.
+func formatDuration(d time.Duration) string {
+  switch {
+  case d >= 24 * time.Hour:
+    return fmt.Sprintf("%dd", int(d.Hours() / 24))
+  case d >= time.Hour:
+    return fmt.Sprintf("%dh", int(d.Hours()))
+  case d >= time.Minute:
+    return fmt.Sprintf("%dm", int(d.Minutes()))
+  }
+
+  return fmt.Sprintf("%ds", int(d.Seconds()))
+}
@@ -0,0 +1,83 @@
+package slackbots
+
+import(
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "testing"
+
+  "github.com/PagerDuty/go-pagerduty"
+)
+
+// pagerDutyTransport sends the PagerDuty client's requests, which always go
+// to api.pagerduty.com on http.DefaultClient, to a test server instead.
+type pagerDutyTransport struct {
+  server *url.URL
+}
+
+func (t pagerDutyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  req.URL.Scheme = t.server.Scheme
+  req.URL.Host = t.server.Host
+
+  return http.DefaultTransport.RoundTrip(req)
+}
+
+// usePagerDuty sends PagerDuty client requests to server until the returned
+// func is called.
+func usePagerDuty(server *httptest.Server) func() {
+  serverURL, _ := url.Parse(server.URL)
+  transport := http.DefaultClient.Transport
+  http.DefaultClient.Transport = pagerDutyTransport{server: serverURL}
+
+  return func() {
+    http.DefaultClient.Transport = transport
+  }
+}
+
+func TestPagerDutyIncidentsFailingBackend(t *testing.T) {
+  defer configurePagerDuty(pagerDutyConfig)
+  configurePagerDuty(PagerDutyConfig{
+    Token: "test-token",
+    Channels: []ChannelConfig{{Name: "ops", ID: "C0TEST", Services: []ServiceConfig{{Name: "api", ID: "PSVC001"}}}},
+  })
+
+  for _, backend := range failingBackends {
+    t.Run(backend.name, func(t *testing.T) {
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      pagerDuty := httptest.NewServer(backend.handler)
+      defer pagerDuty.Close()
+      defer usePagerDuty(pagerDuty)()
+
+      runCommand(t, func() {
+        PagerDutyIncidents(bot, "C0TEST", "ops")
+      })
+      slack.expectReply(t, "Sorry, I ran into a problem listing incidents for #ops :disappointed:")
+    })
+  }
+}
+
+func TestListOpenIncidentsPages(t *testing.T) {
+  pagerDuty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Query().Get("offset") {
+    case "":
+      fmt.Fprint(w, `{"incidents":[{"id":"PINC001","incident_number":1},{"id":"PINC002","incident_number":2}],"limit":2,"more":true}`)
+    case "2":
+      fmt.Fprint(w, `{"incidents":[{"id":"PINC003","incident_number":3}],"limit":2,"offset":2,"more":false}`)
+    default:
+      http.Error(w, "unexpected offset", http.StatusBadRequest)
+    }
+  }))
+  defer pagerDuty.Close()
+  defer usePagerDuty(pagerDuty)()
+
+  client := pagerduty.NewClient("test-token")
+  incidents, err := listOpenIncidents(client, ChannelConfig{Name: "ops", Services: []ServiceConfig{{Name: "api", ID: "PSVC001"}}})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(incidents) != 3 || incidents[2].ID != "PINC003" {
+    t.Errorf("incidents = %+v, want PINC001 to PINC003", incidents)
+  }
+}
@@ -0,0 +1,192 @@
+package slackbots
+
+import(
+  "bytes"
+  "fmt"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+  "github.com/PagerDuty/go-pagerduty"
+)
+
+const (
+  MAINTENANCE_USAGE = "?maintenance 30m reason | ?maintenance list | ?maintenance end <id>"
+  MAINTENANCE_LIST = "list"
+  MAINTENANCE_END = "end"
+  TPL_MAINTENANCE_CREATED = "Maintenance window %s is on for %d services %s: %s"
+  TPL_MAINTENANCE_ENDED = "Maintenance window %s has ended, pages for #%s are live again"
+  TPL_MAINTENANCE_LINE = "%s: %s %s\n"
+  TPL_NO_MAINTENANCE = "No ongoing maintenance windows for #%s"
+  TPL_NO_SERVICES = "Uh oh, #%s has no PagerDuty services"
+  TPL_MAINTENANCE_NOT_CHANNELS = "Uh oh, maintenance window %s isn't on any of #%s's services"
+)
+
+var (
+  maintenanceMutex sync.Mutex
+  // Timers only live in memory, so a window that expires after a restart ends
+  // without a notice in the channel. ?maintenance list still shows it until
+  // then.
+  maintenanceTimers = make(map[string]*time.Timer) // maintenance window ID => expiry notification
+)
+
+func PagerDutyMaintenance(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  if args == nil {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", MAINTENANCE_USAGE))
+    return
+  }
+  var channelConfig ChannelConfig
+  var ok bool
+  if channelConfig, ok = getChannelConfig(msg.ChannelID, msg.ChannelName); !ok {
+    bot.Reply(msg.ChannelID, getChannelNotConfiguredReply(msg.ChannelName))
+    return
+  }
+
+  switch strings.ToLower(args[0]) {
+  case MAINTENANCE_LIST:
+    listMaintenanceWindows(bot, msg, channelConfig)
+  case MAINTENANCE_END:
+    if len(args) != 2 {
+      bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", MAINTENANCE_USAGE))
+      return
+    }
+    endMaintenanceWindow(bot, msg, channelConfig, args[1])
+  default:
+    createMaintenanceWindow(bot, msg, channelConfig, args...)
+  }
+}
+
+func createMaintenanceWindow(bot *slackbot.Bot, msg slackbot.Message, channelConfig ChannelConfig, args ...string) {
+  duration, err := parseDuration(args[0])
+  if err != nil || duration <= 0 || len(args) < 2 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", MAINTENANCE_USAGE))
+    return
+  }
+  reason := strings.Join(args[1:], " ")
+
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  serviceIDs, err := getChannelServiceIDs(client, channelConfig)
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "getting the services for #%s", msg.ChannelName)
+    return
+  }
+  if len(serviceIDs) == 0 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_NO_SERVICES, msg.ChannelName))
+    return
+  }
+  var services []pagerduty.APIObject
+  for _, id := range serviceIDs {
+    services = append(services, pagerduty.APIObject{ID: id, Type: "service_reference"})
+  }
+
+  now := time.Now()
+  window := pagerduty.MaintenanceWindow{
+    StartTime: now.Format(time.RFC3339),
+    EndTime: now.Add(duration).Format(time.RFC3339),
+    Description: fmt.Sprintf("%s (by @%s in #%s)", reason, bot.Users()[msg.UserID], msg.ChannelName),
+    Services: services,
+  }
+  created, err := client.CreateMaintenanceWindows(window)
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "creating a maintenance window for #%s", msg.ChannelName)
+    return
+  }
+
+  // Let the channel know when pages resume, unless the window is ended early
+  // with ?maintenance end.
+  channelID, channelName, windowID := msg.ChannelID, msg.ChannelName, created.ID
+  maintenanceMutex.Lock()
+  maintenanceTimers[windowID] = time.AfterFunc(duration, func() {
+    maintenanceMutex.Lock()
+    delete(maintenanceTimers, windowID)
+    maintenanceMutex.Unlock()
+    bot.Reply(channelID, fmt.Sprintf(TPL_MAINTENANCE_ENDED, windowID, channelName))
+  })
+  maintenanceMutex.Unlock()
+
+  location := getChannelLocation(channelConfig)
+  bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_MAINTENANCE_CREATED, created.ID, len(services), formatMaintenanceWindow(*created, location), reason))
+}
+
+func listMaintenanceWindows(bot *slackbot.Bot, msg slackbot.Message, channelConfig ChannelConfig) {
+  var buffer bytes.Buffer
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  serviceIDs, err := getChannelServiceIDs(client, channelConfig)
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "getting the services for #%s", msg.ChannelName)
+    return
+  }
+  if len(serviceIDs) == 0 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_NO_SERVICES, msg.ChannelName))
+    return
+  }
+  opts := pagerduty.ListMaintenanceWindowsOptions{
+    ServiceIDs: serviceIDs,
+    Filter: "ongoing",
+  }
+  resp, err := client.ListMaintenanceWindows(opts)
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "listing maintenance windows for #%s", msg.ChannelName)
+    return
+  }
+  if len(resp.MaintenanceWindows) == 0 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_NO_MAINTENANCE, msg.ChannelName))
+    return
+  }
+
+  location := getChannelLocation(channelConfig)
+  for _, window := range resp.MaintenanceWindows {
+    buffer.WriteString(fmt.Sprintf(TPL_MAINTENANCE_LINE, window.ID, window.Description, formatMaintenanceWindow(window, location)))
+  }
+  bot.Reply(msg.ChannelID, buffer.String())
+}
+
+// endMaintenanceWindow ends a window, as long as it covers one of the
+// channel's services, so one team can't end another's.
+func endMaintenanceWindow(bot *slackbot.Bot, msg slackbot.Message, channelConfig ChannelConfig, windowID string) {
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  window, err := client.GetMaintenanceWindow(windowID, pagerduty.GetMaintenanceWindowOptions{})
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "getting maintenance window %s", windowID)
+    return
+  }
+  serviceIDs, err := getChannelServiceIDs(client, channelConfig)
+  if err != nil {
+    replyError(bot, msg.ChannelID, err, "getting the services for #%s", msg.ChannelName)
+    return
+  }
+  if !hasMaintenanceService(*window, serviceIDs) {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_MAINTENANCE_NOT_CHANNELS, windowID, msg.ChannelName))
+    return
+  }
+
+  if err := client.DeleteMaintenanceWindow(windowID); err != nil {
+    replyError(bot, msg.ChannelID, err, "ending maintenance window %s", windowID)
+    return
+  }
+
+  maintenanceMutex.Lock()
+  if timer, ok := maintenanceTimers[windowID]; ok {
+    timer.Stop()
+    delete(maintenanceTimers, windowID)
+  }
+  maintenanceMutex.Unlock()
+  bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_MAINTENANCE_ENDED, windowID, msg.ChannelName))
+}
+
+func hasMaintenanceService(window pagerduty.MaintenanceWindow, serviceIDs []string) bool {
+  for _, service := range window.Services {
+    for _, id := range serviceIDs {
+      if service.ID == id {
+        return true
+      }
+    }
+  }
+
+  return false
+}
+
+func formatMaintenanceWindow(window pagerduty.MaintenanceWindow, location *time.Location) string {
+  return formatOnCallWindow(pagerduty.OnCall{Start: window.StartTime, End: window.EndTime}, location)
+}
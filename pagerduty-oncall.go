@@ -5,48 +5,94 @@ import(
   "fmt"
   "log"
   "sort"
+  "strings"
+  "time"
 
-  "github.com/premshree/lib-slackbot"
+  "github.com/premshree/slackbots/slackbot"
   "github.com/PagerDuty/go-pagerduty"
-  "github.com/spf13/viper"
 )
 
 const (
-  CONFIG_ENV_PREFIX = "pagerduty_oncall"
   TPL_CHANNEL_NOT_CONFIGURED = "Uh oh, #%s is not configured for ?oncall"
+  TPL_DM_NOT_CONFIGURED = "Uh oh, direct messages aren't tied to a team. Try ?oncall <team>"
+  TPL_TEAM_NOT_CONFIGURED = "Uh oh, %s is not a team configured for ?oncall"
+  TPL_NO_ESCALATION_POLICY = "Uh oh, #%s has no escalation policy configured for ?oncall"
+  TPL_NO_ONCALLS = "Nobody is on call for #%s"
+  ONCALL_USAGE = "?oncall [team] [next|week|override]"
+  ONCALL_MODE_NOW = "now"
+  ONCALL_MODE_NEXT = "next"
+  ONCALL_MODE_WEEK = "week"
+  ONCALL_MODE_OVERRIDE = "override"
+  ONCALL_WEEK = 7 * 24 * time.Hour
+  ONCALL_TIME_FORMAT = "Mon Jan 2 15:04 MST"
+  DEFAULT_MAX_ESCALATION_LEVEL = 3
+  SLACK_DM_ID_PREFIX = "D"
+  PAGERDUTY_PAGE_SIZE = 100 // the most PagerDuty returns at once
 )
 
-type Config struct {
-  Channels []ChannelConfig
+type PagerDutyConfig struct {
+  Token string `mapstructure:"token"`
+  WebhookSecret string `mapstructure:"webhook_secret"` // required in the /pagerduty webhook URL
+  Channels []ChannelConfig `mapstructure:"channels"`
+  Users []PagerDutyUserConfig `mapstructure:"users"`
+}
+
+// PagerDutyUserConfig links a Slack user to their PagerDuty login. It's a list
+// rather than a map keyed by username, since the config can't have dots in
+// keys and usernames like john.doe are common.
+type PagerDutyUserConfig struct {
+  SlackUser string `mapstructure:"slack_user"` // Slack username or user ID
+  Email string `mapstructure:"email"`
+}
+
+// Enabled reports whether any of PagerDuty is configured, in which case it
+// all has to be.
+func (cfg PagerDutyConfig) Enabled() bool {
+  return cfg.Token != "" || len(cfg.Channels) > 0
 }
 
 type ChannelConfig struct {
   Name string `mapstructure:"name"`
-  EscalationPolicyID string `mapstructure:"escalation_policy_id"`
+  ID string `mapstructure:"id"` // Slack channel ID, takes precedence over name
+  Team string `mapstructure:"team"` // for ?oncall <team>, defaults to name
+  EscalationPolicyID string `mapstructure:"escalation_policy_id"` // single-policy shorthand for escalation_policies
+  EscalationPolicies []EscalationPolicyConfig `mapstructure:"escalation_policies"`
+  Schedules []ScheduleConfig `mapstructure:"schedules"`
+  Services []ServiceConfig `mapstructure:"services"`
+  TimeZone string `mapstructure:"time_zone"` // e.g. America/New_York, defaults to UTC
+  MaxEscalationLevel int `mapstructure:"max_escalation_level"` // defaults to 3
+}
+
+type EscalationPolicyConfig struct {
+  ID string `mapstructure:"id"`
+  Label string `mapstructure:"label"`
+}
+
+// ScheduleConfig is a schedule ?oncall override can put people on. Without
+// any, overrides go on the first schedule of the channel's escalation policy.
+type ScheduleConfig struct {
+  ID string `mapstructure:"id"`
+  Label string `mapstructure:"label"`
+}
+
+// ServiceConfig is a PagerDuty service that belongs to a channel. Services
+// with an IntegrationKey (the service's Events API key) can be paged with
+// ?page; services with an ID are included in ?incidents and ?maintenance
+// alongside the escalation policies' services.
+type ServiceConfig struct {
+  Name string `mapstructure:"name"`
+  ID string `mapstructure:"id"`
+  IntegrationKey string `mapstructure:"integration_key"`
+  Label string `mapstructure:"label"`
 }
 
 var (
-  config Config
+  pagerDutyConfig PagerDutyConfig
   channelConfigMap map[string]ChannelConfig
-  token string
 )
 
-func init() {
-  viper := viper.New()
-  viper.SetConfigFile("./config/pagerduty-oncall.json")
-  viper.SetEnvPrefix(CONFIG_ENV_PREFIX)
-  viper.AutomaticEnv()
-  err := viper.ReadInConfig()
-  if err != nil {
-    log.Fatalf("Error reading config file: %v", err)
-  }
-
-  err = viper.Unmarshal(&config)
-  if err != nil {
-    log.Fatalf("unable to decode config into struct: %v", err)
-  }
-
-  token = viper.GetString("TOKEN")
+func configurePagerDuty(cfg PagerDutyConfig) {
+  pagerDutyConfig = cfg
   channelConfigMap = getChannelConfigMap()
 }
 
@@ -54,48 +100,315 @@ func PagerDutyOnCall(bot *slackbot.Bot, channelID string, channelName string, ar
   var buffer bytes.Buffer
   var channelConfig ChannelConfig
   var ok bool
-  if channelConfig, ok = channelConfigMap[channelName]; !ok {
-    bot.Reply(channelID, fmt.Sprintf(TPL_CHANNEL_NOT_CONFIGURED, channelName))
+  // ?oncall <team> works from any channel, including DMs
+  if args != nil && !isOnCallMode(args[0]) {
+    if channelConfig, ok = getTeamConfig(args[0]); !ok {
+      bot.Reply(channelID, fmt.Sprintf(TPL_TEAM_NOT_CONFIGURED, args[0]))
+      return
+    }
+    channelName = channelConfig.Name
+    args = args[1:]
+  } else if channelConfig, ok = getChannelConfig(channelID, channelName); !ok {
+    bot.Reply(channelID, getChannelNotConfiguredReply(channelName))
+    return
+  }
+  mode := ONCALL_MODE_NOW
+  if len(args) > 0 {
+    mode = strings.ToLower(args[0])
+  }
+  if mode == ONCALL_MODE_OVERRIDE {
+    pagerDutyOverride(bot, channelID, channelName, channelConfig, args[1:]...)
+    return
+  }
+  if !isOnCallMode(mode) {
+    bot.Reply(channelID, fmt.Sprintf("Usage: %s", ONCALL_USAGE))
+    return
+  }
+  // Without a policy to filter on, PagerDuty would list every on-call
+  escalationPolicyIDs := getEscalationPolicyIDs(channelConfig)
+  if len(escalationPolicyIDs) == 0 {
+    bot.Reply(channelID, fmt.Sprintf(TPL_NO_ESCALATION_POLICY, channelName))
     return
   }
+  location := getChannelLocation(channelConfig)
   opts := pagerduty.ListOnCallOptions{
-    EscalationPolicyIDs: []string{channelConfig.EscalationPolicyID},
+    EscalationPolicyIDs: escalationPolicyIDs,
+    TimeZone: location.String(),
+  }
+  now := time.Now().In(location)
+  if mode != ONCALL_MODE_NOW {
+    opts.Since = now.Format(time.RFC3339)
+    opts.Until = now.Add(ONCALL_WEEK).Format(time.RFC3339)
   }
 
-  client := pagerduty.NewClient(token)
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  onCalls, err := listAllOnCalls(client, opts)
+  if err != nil {
+    replyError(bot, channelID, err, "listing on-calls for #%s", channelName)
+    return
+  }
+  escalationPolicies := getEscalationPolicies(channelConfig)
+  onCallsByPolicy := make(map[string][]pagerduty.OnCall)
+  for _, oncall := range onCalls {
+    onCallsByPolicy[oncall.EscalationPolicy.ID] = append(onCallsByPolicy[oncall.EscalationPolicy.ID], oncall)
+  }
+  for _, escalationPolicy := range escalationPolicies {
+    if len(escalationPolicies) > 1 || escalationPolicy.Label != "" {
+      buffer.WriteString(fmt.Sprintf("*%s*\n", getEscalationPolicyLabel(escalationPolicy, onCallsByPolicy[escalationPolicy.ID])))
+    }
+    writeOnCallLevels(&buffer, mode, channelConfig, onCallsByPolicy[escalationPolicy.ID], now)
+  }
+  if len(onCalls) == 0 || buffer.Len() == 0 {
+    bot.Reply(channelID, fmt.Sprintf(TPL_NO_ONCALLS, channelName))
+    return
+  }
+  bot.Reply(channelID, buffer.String())
+}
+
+// writeOnCallLevels renders one escalation policy's on-calls, level by level,
+// up to the channel's max_escalation_level.
+func writeOnCallLevels(buffer *bytes.Buffer, mode string, channelConfig ChannelConfig, oncalls []pagerduty.OnCall, now time.Time) {
   var escalationLevels []int
-  if onCalls, err := client.ListOnCalls(opts); err != nil {
-    log.Fatalf("Error listing on-calls for #%s", channelName)
-  } else {
-    escalationPolicyMap := getEscalationPolicyMap(onCalls.OnCalls)
-    for e := range escalationPolicyMap {
-      escalationLevels = append(escalationLevels, e)
+  location := getChannelLocation(channelConfig)
+  escalationPolicyMap := getEscalationPolicyMap(oncalls)
+  for e := range escalationPolicyMap {
+    escalationLevels = append(escalationLevels, e)
+  }
+  sort.Ints(escalationLevels)
+  for _, k := range escalationLevels {
+    if k > getMaxEscalationLevel(channelConfig) {
+      break
     }
-    sort.Ints(escalationLevels)
-    for _, k := range escalationLevels {
-      if k > 3 {
-        break
+    switch mode {
+    case ONCALL_MODE_NOW:
+      buffer.WriteString(fmt.Sprintf("Level %d: %s\n", k, getOnCallNames(escalationPolicyMap[k])))
+    case ONCALL_MODE_NEXT:
+      if oncall, ok := getNextOnCall(escalationPolicyMap[k], now); ok {
+        buffer.WriteString(fmt.Sprintf("Level %d: %s %s\n", k, oncall.User.Summary, formatOnCallWindow(oncall, location)))
+      } else {
+        buffer.WriteString(fmt.Sprintf("Level %d: no hand-off in the next week\n", k))
+      }
+    case ONCALL_MODE_WEEK:
+      buffer.WriteString(fmt.Sprintf("Level %d:\n", k))
+      for _, oncall := range escalationPolicyMap[k] {
+        buffer.WriteString(fmt.Sprintf("  %s %s\n", oncall.User.Summary, formatOnCallWindow(oncall, location)))
       }
-      buffer.WriteString(fmt.Sprintf("Level %d: %s\n", k, escalationPolicyMap[k]))
     }
-    bot.Reply(channelID, buffer.String())
   }
 }
 
-func getEscalationPolicyMap(oncalls []pagerduty.OnCall) map[int]string {
-  escalationPolicyMap := make(map[int]string, 0)
+// getEscalationPolicies returns every escalation policy configured for a
+// channel, including the single escalation_policy_id older configs use.
+func getEscalationPolicies(channelConfig ChannelConfig) []EscalationPolicyConfig {
+  escalationPolicies := channelConfig.EscalationPolicies
+  if channelConfig.EscalationPolicyID != "" {
+    escalationPolicies = append([]EscalationPolicyConfig{{ID: channelConfig.EscalationPolicyID}}, escalationPolicies...)
+  }
+
+  return escalationPolicies
+}
+
+func getEscalationPolicyIDs(channelConfig ChannelConfig) []string {
+  var ids []string
+  for _, escalationPolicy := range getEscalationPolicies(channelConfig) {
+    ids = append(ids, escalationPolicy.ID)
+  }
+
+  return ids
+}
+
+// getEscalationPolicyLabel prefers the configured label, then the policy's
+// name in PagerDuty.
+func getEscalationPolicyLabel(escalationPolicy EscalationPolicyConfig, oncalls []pagerduty.OnCall) string {
+  if escalationPolicy.Label != "" {
+    return escalationPolicy.Label
+  }
+  if len(oncalls) > 0 && oncalls[0].EscalationPolicy.Summary != "" {
+    return oncalls[0].EscalationPolicy.Summary
+  }
+
+  return escalationPolicy.ID
+}
+
+// listAllOnCalls pages through ListOnCalls, since a week of several levels
+// and policies is often more than one page. The vendored response doesn't
+// have PagerDuty's "more", so a short page is the last one.
+func listAllOnCalls(client *pagerduty.Client, opts pagerduty.ListOnCallOptions) ([]pagerduty.OnCall, error) {
+  var onCalls []pagerduty.OnCall
+  opts.Limit = PAGERDUTY_PAGE_SIZE
+  for {
+    resp, err := client.ListOnCalls(opts)
+    if err != nil {
+      return nil, err
+    }
+    onCalls = append(onCalls, resp.OnCalls...)
+    if len(resp.OnCalls) < PAGERDUTY_PAGE_SIZE {
+      return onCalls, nil
+    }
+    opts.Offset += PAGERDUTY_PAGE_SIZE
+  }
+}
+
+// getEscalationPolicyMap groups on-call entries by escalation level, ordered by
+// when each shift starts.
+func getEscalationPolicyMap(oncalls []pagerduty.OnCall) map[int][]pagerduty.OnCall {
+  escalationPolicyMap := make(map[int][]pagerduty.OnCall, 0)
   for _, oncall := range oncalls {
-    escalationPolicyMap[int(oncall.EscalationLevel)] = oncall.User.Summary
+    level := int(oncall.EscalationLevel)
+    escalationPolicyMap[level] = append(escalationPolicyMap[level], oncall)
+  }
+  for _, levelOnCalls := range escalationPolicyMap {
+    sort.Sort(byOnCallStart(levelOnCalls))
   }
 
   return escalationPolicyMap
 }
 
+type byOnCallStart []pagerduty.OnCall
+
+func (o byOnCallStart) Len() int { return len(o) }
+func (o byOnCallStart) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o byOnCallStart) Less(i, j int) bool { return o[i].Start < o[j].Start }
+
+func getOnCallNames(oncalls []pagerduty.OnCall) string {
+  var names []string
+  for _, oncall := range oncalls {
+    names = append(names, oncall.User.Summary)
+  }
+
+  return strings.Join(names, ", ")
+}
+
+// getNextOnCall returns the first shift on a level that starts after now,
+// i.e. whoever the pager is handed off to next.
+func getNextOnCall(oncalls []pagerduty.OnCall, now time.Time) (pagerduty.OnCall, bool) {
+  for _, oncall := range oncalls {
+    start, err := time.Parse(time.RFC3339, oncall.Start)
+    if err == nil && start.After(now) {
+      return oncall, true
+    }
+  }
+
+  return pagerduty.OnCall{}, false
+}
+
+// formatOnCallWindow renders the hand-off times of a shift in the channel's
+// time zone. Users on an escalation rule directly have no start or end.
+func formatOnCallWindow(oncall pagerduty.OnCall, location *time.Location) string {
+  start, startErr := time.Parse(time.RFC3339, oncall.Start)
+  end, endErr := time.Parse(time.RFC3339, oncall.End)
+  if startErr != nil || endErr != nil {
+    return "(always on call)"
+  }
+
+  return fmt.Sprintf("from %s until %s", start.In(location).Format(ONCALL_TIME_FORMAT), end.In(location).Format(ONCALL_TIME_FORMAT))
+}
+
+func getChannelLocation(channelConfig ChannelConfig) *time.Location {
+  if channelConfig.TimeZone == "" {
+    return time.UTC
+  }
+  location, err := time.LoadLocation(channelConfig.TimeZone)
+  if err != nil {
+    log.Printf("Invalid time_zone %q for #%s: %v", channelConfig.TimeZone, channelConfig.Name, err)
+    return time.UTC
+  }
+
+  return location
+}
+
+func getMaxEscalationLevel(channelConfig ChannelConfig) int {
+  if channelConfig.MaxEscalationLevel == 0 {
+    return DEFAULT_MAX_ESCALATION_LEVEL
+  }
+
+  return channelConfig.MaxEscalationLevel
+}
+
+func isOnCallMode(arg string) bool {
+  switch strings.ToLower(arg) {
+  case ONCALL_MODE_NOW, ONCALL_MODE_NEXT, ONCALL_MODE_WEEK, ONCALL_MODE_OVERRIDE:
+    return true
+  }
+
+  return false
+}
+
+// getChannelConfigMap keys channel configs by channel ID when the config has
+// one, so renaming a channel doesn't break it, and by name otherwise.
 func getChannelConfigMap() map[string]ChannelConfig {
   channelConfigMap := make(map[string]ChannelConfig)
-  for _, channel := range config.Channels {
-    channelConfigMap[channel.Name] = channel
+  for _, channel := range pagerDutyConfig.Channels {
+    if channel.ID != "" {
+      channelConfigMap[channel.ID] = channel
+    } else {
+      channelConfigMap[channel.Name] = channel
+    }
   }
 
   return channelConfigMap
 }
+
+func getChannelConfig(channelID string, channelName string) (ChannelConfig, bool) {
+  if channelConfig, ok := channelConfigMap[channelID]; ok {
+    return channelConfig, true
+  }
+  if channelName == "" {
+    return ChannelConfig{}, false
+  }
+  channelConfig, ok := channelConfigMap[channelName]
+
+  return channelConfig, ok
+}
+
+// getTeamConfig finds a config entry by its team, falling back to its channel
+// name.
+func getTeamConfig(team string) (ChannelConfig, bool) {
+  for _, channelConfig := range pagerDutyConfig.Channels {
+    if strings.EqualFold(channelConfig.Team, team) {
+      return channelConfig, true
+    }
+  }
+  for _, channelConfig := range pagerDutyConfig.Channels {
+    if strings.EqualFold(channelConfig.Name, team) {
+      return channelConfig, true
+    }
+  }
+
+  return ChannelConfig{}, false
+}
+
+// getChannelNotConfiguredReply explains a missing config. DMs have no channel
+// name, so they can only use named teams.
+func getChannelNotConfiguredReply(channelName string) string {
+  if channelName == "" {
+    return TPL_DM_NOT_CONFIGURED
+  }
+
+  return fmt.Sprintf(TPL_CHANNEL_NOT_CONFIGURED, channelName)
+}
+
+// getConfiguredChannelID returns the Slack channel a config entry posts to.
+// bot.Channels() only has channels and private channels, so a DM ID (D...)
+// is taken as is.
+func getConfiguredChannelID(bot *slackbot.Bot, channelConfig ChannelConfig) (string, bool) {
+  if strings.HasPrefix(channelConfig.ID, SLACK_DM_ID_PREFIX) {
+    return channelConfig.ID, true
+  }
+  if channelConfig.ID != "" {
+    _, ok := bot.Channels()[channelConfig.ID]
+    return channelConfig.ID, ok
+  }
+
+  return getChannelID(bot, channelConfig.Name)
+}
+
+// WarnUnmatchedChannels logs every PagerDuty config entry that doesn't match a
+// channel the bot can see, e.g. after a channel was renamed or archived.
+func WarnUnmatchedChannels(bot *slackbot.Bot) {
+  for _, channelConfig := range pagerDutyConfig.Channels {
+    if _, ok := getConfiguredChannelID(bot, channelConfig); !ok {
+      log.Printf("Warning: PagerDuty config for channel %q (id %q) matches no Slack channel", channelConfig.Name, channelConfig.ID)
+    }
+  }
+}
@@ -0,0 +1,75 @@
+package slackbots
+
+import(
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "sync/atomic"
+  "testing"
+)
+
+func TestPagerDutyOnCallNothingToShow(t *testing.T) {
+  tests := []struct {
+    name string
+    channelConfig ChannelConfig
+    calls int32
+    reply string
+  }{
+    {
+      name: "services only",
+      channelConfig: ChannelConfig{Name: "ops", ID: "C0TEST", Services: []ServiceConfig{{Name: "api", ID: "PSVC001"}}},
+      calls: 0,
+      reply: fmt.Sprintf(TPL_NO_ESCALATION_POLICY, "ops"),
+    },
+    {
+      name: "nobody on call",
+      channelConfig: ChannelConfig{Name: "ops", ID: "C0TEST", EscalationPolicyID: "PESC001"},
+      calls: 1,
+      reply: fmt.Sprintf(TPL_NO_ONCALLS, "ops"),
+    },
+  }
+  defer configurePagerDuty(pagerDutyConfig)
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      configurePagerDuty(PagerDutyConfig{Token: "test-token", Channels: []ChannelConfig{test.channelConfig}})
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      var calls int32
+      pagerDuty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&calls, 1)
+        fmt.Fprint(w, `{"oncalls":[]}`)
+      }))
+      defer pagerDuty.Close()
+      defer usePagerDuty(pagerDuty)()
+
+      PagerDutyOnCall(bot, "C0TEST", "ops")
+      if got := atomic.LoadInt32(&calls); got != test.calls {
+        t.Errorf("PagerDuty calls = %d, want %d", got, test.calls)
+      }
+      slack.expectReply(t, test.reply)
+    })
+  }
+}
+
+func TestPagerDutyOnCallFailingBackend(t *testing.T) {
+  defer configurePagerDuty(pagerDutyConfig)
+  configurePagerDuty(PagerDutyConfig{
+    Token: "test-token",
+    Channels: []ChannelConfig{{Name: "ops", ID: "C0TEST", EscalationPolicyID: "PESC001"}},
+  })
+
+  for _, backend := range failingBackends {
+    t.Run(backend.name, func(t *testing.T) {
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      pagerDuty := httptest.NewServer(backend.handler)
+      defer pagerDuty.Close()
+      defer usePagerDuty(pagerDuty)()
+
+      runCommand(t, func() {
+        PagerDutyOnCall(bot, "C0TEST", "ops")
+      })
+      slack.expectReply(t, "Sorry, I ran into a problem listing on-calls for #ops :disappointed:")
+    })
+  }
+}
@@ -0,0 +1,223 @@
+package slackbots
+
+import(
+  "fmt"
+  "regexp"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+  "github.com/PagerDuty/go-pagerduty"
+)
+
+const (
+  OVERRIDE_USAGE = "?oncall override @user 4h [schedule] | ?oncall override cancel"
+  OVERRIDE_CANCEL = "cancel"
+  SLACK_MENTION_PATTERN = "^<@([A-Z0-9]+)(\\|[^>]*)?>$"
+  TPL_OVERRIDE_CREATED = "%s is on call for %s %s (override %s)"
+  TPL_OVERRIDE_CANCELLED = "Cancelled override %s for %s %s"
+  TPL_NO_OVERRIDE = "I haven't created any overrides in #%s"
+  TPL_NO_SCHEDULE = "Uh oh, #%s has no schedule to override"
+  TPL_SCHEDULE_NOT_CONFIGURED = "Uh oh, #%s has no schedule labelled %s"
+)
+
+type override struct {
+  ScheduleID string
+  Override pagerduty.Override
+}
+
+var (
+  overridesMutex sync.Mutex
+  createdOverrides = make(map[string][]override) // channel ID => overrides, oldest first
+)
+
+// pagerDutyOverride handles ?oncall override. Overrides go on the schedule
+// named by label, else the channel's first configured schedule, else the first
+// schedule targeted by the channel's escalation policies.
+func pagerDutyOverride(bot *slackbot.Bot, channelID string, channelName string, channelConfig ChannelConfig, args ...string) {
+  if len(args) == 1 && strings.ToLower(args[0]) == OVERRIDE_CANCEL {
+    cancelOverride(bot, channelID, channelName, channelConfig)
+    return
+  }
+  if len(args) != 2 && len(args) != 3 {
+    bot.Reply(channelID, fmt.Sprintf("Usage: %s", OVERRIDE_USAGE))
+    return
+  }
+  var scheduleLabel string
+  if len(args) == 3 {
+    scheduleLabel = args[2]
+  }
+  slackUserID, ok := parseSlackMention(args[0])
+  if !ok {
+    bot.Reply(channelID, fmt.Sprintf("Usage: %s", OVERRIDE_USAGE))
+    return
+  }
+  duration, err := parseDuration(args[1])
+  if err != nil || duration <= 0 {
+    bot.Reply(channelID, fmt.Sprintf("Uh oh, %s is not a duration like 30m, 4h or 2d", args[1]))
+    return
+  }
+  userName := bot.Users()[slackUserID]
+  email, ok := getPagerDutyEmail(slackUserID, userName)
+  if !ok {
+    bot.Reply(channelID, fmt.Sprintf("Sorry, @%s isn't linked to a PagerDuty user", userName))
+    return
+  }
+
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  scheduleID, err := getOverrideScheduleID(client, channelConfig, scheduleLabel)
+  if err != nil {
+    replyError(bot, channelID, err, "getting the schedule for #%s", channelName)
+    return
+  }
+  if scheduleID == "" && scheduleLabel != "" {
+    bot.Reply(channelID, fmt.Sprintf(TPL_SCHEDULE_NOT_CONFIGURED, channelName, scheduleLabel))
+    return
+  }
+  if scheduleID == "" {
+    bot.Reply(channelID, fmt.Sprintf(TPL_NO_SCHEDULE, channelName))
+    return
+  }
+  user, err := getPagerDutyUserByEmail(client, email)
+  if err != nil {
+    replyError(bot, channelID, err, "looking up @%s in PagerDuty", userName)
+    return
+  }
+
+  now := time.Now()
+  o := pagerduty.Override{
+    Start: now.Format(time.RFC3339),
+    End: now.Add(duration).Format(time.RFC3339),
+    User: pagerduty.APIObject{
+      ID: user.ID,
+      Type: "user_reference",
+    },
+  }
+  created, err := client.CreateOverride(scheduleID, o)
+  if err != nil {
+    replyError(bot, channelID, err, "creating an override for @%s", userName)
+    return
+  }
+
+  overridesMutex.Lock()
+  createdOverrides[channelID] = append(createdOverrides[channelID], override{
+    ScheduleID: scheduleID,
+    Override: *created,
+  })
+  overridesMutex.Unlock()
+
+  location := getChannelLocation(channelConfig)
+  bot.Reply(channelID, fmt.Sprintf(TPL_OVERRIDE_CREATED, user.Name, formatDuration(duration), formatOverrideWindow(*created, location), created.ID))
+}
+
+// cancelOverride deletes the most recent override this bot created in the
+// channel. Overrides made in the PagerDuty UI are left alone. The override is
+// taken off the list before calling PagerDuty, so overridesMutex isn't held
+// while waiting on it, and goes back on if the delete fails.
+func cancelOverride(bot *slackbot.Bot, channelID string, channelName string, channelConfig ChannelConfig) {
+  overridesMutex.Lock()
+  overrides := createdOverrides[channelID]
+  if len(overrides) == 0 {
+    overridesMutex.Unlock()
+    bot.Reply(channelID, fmt.Sprintf(TPL_NO_OVERRIDE, channelName))
+    return
+  }
+  last := overrides[len(overrides) - 1]
+  createdOverrides[channelID] = overrides[:len(overrides) - 1]
+  overridesMutex.Unlock()
+
+  client := pagerduty.NewClient(pagerDutyConfig.Token)
+  if err := client.DeleteOverride(last.ScheduleID, last.Override.ID); err != nil {
+    overridesMutex.Lock()
+    createdOverrides[channelID] = append(createdOverrides[channelID], last)
+    overridesMutex.Unlock()
+    replyError(bot, channelID, err, "cancelling override %s", last.Override.ID)
+    return
+  }
+
+  location := getChannelLocation(channelConfig)
+  bot.Reply(channelID, fmt.Sprintf(TPL_OVERRIDE_CANCELLED, last.Override.ID, last.Override.User.Summary, formatOverrideWindow(last.Override, location)))
+}
+
+func getOverrideScheduleID(client *pagerduty.Client, channelConfig ChannelConfig, label string) (string, error) {
+  if label != "" {
+    for _, schedule := range channelConfig.Schedules {
+      if strings.EqualFold(schedule.Label, label) || schedule.ID == label {
+        return schedule.ID, nil
+      }
+    }
+    return "", nil
+  }
+  if len(channelConfig.Schedules) > 0 {
+    return channelConfig.Schedules[0].ID, nil
+  }
+  for _, escalationPolicyID := range getEscalationPolicyIDs(channelConfig) {
+    scheduleID, err := getEscalationPolicyScheduleID(client, escalationPolicyID)
+    if err != nil || scheduleID != "" {
+      return scheduleID, err
+    }
+  }
+
+  return "", nil
+}
+
+// getEscalationPolicyScheduleID returns the first schedule targeted by the
+// escalation policy's rules, or "" if every rule targets users directly.
+func getEscalationPolicyScheduleID(client *pagerduty.Client, escalationPolicyID string) (string, error) {
+  escalationPolicy, err := client.GetEscalationPolicy(escalationPolicyID, &pagerduty.GetEscalationPolicyOptions{})
+  if err != nil {
+    return "", err
+  }
+  for _, rule := range escalationPolicy.EscalationRules {
+    for _, target := range rule.Targets {
+      if target.Type == "schedule" || target.Type == "schedule_reference" {
+        return target.ID, nil
+      }
+    }
+  }
+
+  return "", nil
+}
+
+func getPagerDutyUserByEmail(client *pagerduty.Client, email string) (pagerduty.User, error) {
+  resp, err := client.ListUsers(pagerduty.ListUsersOptions{Query: email})
+  if err != nil {
+    return pagerduty.User{}, err
+  }
+  for _, user := range resp.Users {
+    if strings.EqualFold(user.Email, email) {
+      return user, nil
+    }
+  }
+
+  return pagerduty.User{}, fmt.Errorf("no PagerDuty user with email %s", email)
+}
+
+func formatOverrideWindow(o pagerduty.Override, location *time.Location) string {
+  return formatOnCallWindow(pagerduty.OnCall{Start: o.Start, End: o.End}, location)
+}
+
+// parseSlackMention returns the user ID from a <@U123> or <@U123|name> mention.
+func parseSlackMention(mention string) (string, bool) {
+  matches := regexp.MustCompile(SLACK_MENTION_PATTERN).FindStringSubmatch(mention)
+  if matches == nil {
+    return "", false
+  }
+
+  return matches[1], true
+}
+
+// parseDuration is time.ParseDuration plus whole days, e.g. 2d.
+func parseDuration(s string) (time.Duration, error) {
+  if strings.HasSuffix(s, "d") {
+    days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+    if err != nil {
+      return 0, err
+    }
+    return time.Duration(days) * 24 * time.Hour, nil
+  }
+
+  return time.ParseDuration(s)
+}
@@ -0,0 +1,43 @@
+package slackbots
+
+import(
+  "net/http/httptest"
+  "testing"
+
+  "github.com/PagerDuty/go-pagerduty"
+)
+
+func TestCancelOverrideFailingBackend(t *testing.T) {
+  for _, backend := range failingBackends {
+    if backend.name == "bad JSON" {
+      continue // a delete doesn't read the body, so a 200 is a success
+    }
+    t.Run(backend.name, func(t *testing.T) {
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      pagerDuty := httptest.NewServer(backend.handler)
+      defer pagerDuty.Close()
+      defer usePagerDuty(pagerDuty)()
+      o := override{ScheduleID: "PSCHED1", Override: pagerduty.Override{ID: "POVER1"}}
+      overridesMutex.Lock()
+      createdOverrides["C0TEST"] = []override{o}
+      overridesMutex.Unlock()
+      defer func() {
+        overridesMutex.Lock()
+        delete(createdOverrides, "C0TEST")
+        overridesMutex.Unlock()
+      }()
+
+      runCommand(t, func() {
+        cancelOverride(bot, "C0TEST", "ops", ChannelConfig{Name: "ops"})
+      })
+      slack.expectReply(t, "Sorry, I ran into a problem cancelling override POVER1 :disappointed:")
+      overridesMutex.Lock()
+      overrides := createdOverrides["C0TEST"]
+      overridesMutex.Unlock()
+      if len(overrides) != 1 || overrides[0].Override.ID != "POVER1" {
+        t.Errorf("overrides = %+v, want POVER1 back on the list", overrides)
+      }
+    })
+  }
+}
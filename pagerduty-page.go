@@ -0,0 +1,153 @@
+package slackbots
+
+import(
+  "bytes"
+  "crypto/sha1"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+  "github.com/PagerDuty/go-pagerduty"
+)
+
+const (
+  PAGE_USAGE = "?page service description"
+  PAGE_DEDUP_WINDOW = 10 * time.Minute
+  PAGE_CLIENT = "omnibot"
+  PAGERDUTY_EVENTS_URL = "https://events.pagerduty.com/generic/2010-04-15/create_event.json"
+  PAGERDUTY_EVENTS_TIMEOUT = 5 // seconds
+  TPL_SERVICE_NOT_CONFIGURED = "Uh oh, %s is not a service #%s can page. Try one of: %s"
+  TPL_NO_PAGEABLE_SERVICES = "Uh oh, #%s has no services with an integration_key to page"
+  TPL_PAGE_TRIGGERED = "Paged %s: incident key `%s`"
+  TPL_PAGE_DEDUPED = "%s was already paged for this %s ago: incident key `%s`"
+)
+
+var (
+  pagesMutex sync.Mutex
+  recentPages = make(map[string]time.Time) // dedup key => triggered at
+)
+
+func PagerDutyPage(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  if len(args) < 2 {
+    bot.Reply(msg.ChannelID, fmt.Sprintf("Usage: %s", PAGE_USAGE))
+    return
+  }
+  var channelConfig ChannelConfig
+  var ok bool
+  if channelConfig, ok = getChannelConfig(msg.ChannelID, msg.ChannelName); !ok {
+    bot.Reply(msg.ChannelID, getChannelNotConfiguredReply(msg.ChannelName))
+    return
+  }
+  var service ServiceConfig
+  if service, ok = getServiceConfig(channelConfig, args[0]); !ok {
+    if names := getServiceNames(channelConfig); names != "" {
+      bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_SERVICE_NOT_CONFIGURED, args[0], msg.ChannelName, names))
+    } else {
+      bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_NO_PAGEABLE_SERVICES, msg.ChannelName))
+    }
+    return
+  }
+  description := strings.Join(args[1:], " ")
+  dedupKey := getDedupKey(msg.ChannelName, service.Name, description)
+
+  // Reserve the key before paging, so the same page sent twice while the
+  // first is in flight is deduped too, without holding the lock over HTTP
+  pagesMutex.Lock()
+  if triggeredAt, ok := recentPages[dedupKey]; ok && time.Since(triggeredAt) < PAGE_DEDUP_WINDOW {
+    pagesMutex.Unlock()
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_PAGE_DEDUPED, service.Name, formatDuration(time.Since(triggeredAt)), dedupKey))
+    return
+  }
+  recentPages[dedupKey] = time.Now()
+  pagesMutex.Unlock()
+
+  // The dedup key doubles as PagerDuty's incident key, so PagerDuty also
+  // folds repeats after our window into the same open incident
+  event := pagerduty.Event{
+    ServiceKey: service.IntegrationKey,
+    Type: "trigger",
+    IncidentKey: dedupKey,
+    Description: description,
+    Client: PAGE_CLIENT,
+    Details: map[string]string{
+      "paged_by": bot.Users()[msg.UserID],
+      "channel": msg.ChannelName,
+    },
+  }
+  resp, err := createPagerDutyEvent(event)
+  if err != nil {
+    pagesMutex.Lock()
+    delete(recentPages, dedupKey)
+    pagesMutex.Unlock()
+    replyError(bot, msg.ChannelID, err, "paging %s", service.Name)
+    return
+  }
+  bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_PAGE_TRIGGERED, service.Name, resp.IncidentKey))
+}
+
+// createPagerDutyEvent is pagerduty.CreateEvent with a timeout, which the
+// vendored one, on http.DefaultClient, doesn't have.
+func createPagerDutyEvent(event pagerduty.Event) (*pagerduty.EventResponse, error) {
+  data, err := json.Marshal(event)
+  if err != nil {
+    return nil, err
+  }
+  client := &http.Client{
+    Timeout: time.Duration(PAGERDUTY_EVENTS_TIMEOUT * time.Second),
+  }
+  resp, err := client.Post(PAGERDUTY_EVENTS_URL, "application/json", bytes.NewBuffer(data))
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("POST %s: %s", PAGERDUTY_EVENTS_URL, resp.Status)
+  }
+  var eventResponse pagerduty.EventResponse
+  if err := json.NewDecoder(resp.Body).Decode(&eventResponse); err != nil {
+    return nil, err
+  }
+
+  return &eventResponse, nil
+}
+
+// getServiceConfig finds a service ?page can trigger. Services without an
+// integration_key are only for ?incidents and ?maintenance.
+func getServiceConfig(channelConfig ChannelConfig, name string) (ServiceConfig, bool) {
+  for _, service := range channelConfig.Services {
+    if service.IntegrationKey != "" && strings.EqualFold(service.Name, name) {
+      return service, true
+    }
+  }
+
+  return ServiceConfig{}, false
+}
+
+// getServiceNames lists the services ?page can trigger.
+func getServiceNames(channelConfig ChannelConfig) string {
+  var buffer bytes.Buffer
+  for _, service := range channelConfig.Services {
+    if service.IntegrationKey == "" {
+      continue
+    }
+    if buffer.Len() > 0 {
+      buffer.WriteString(", ")
+    }
+    buffer.WriteString(service.Name)
+  }
+
+  return buffer.String()
+}
+
+// getDedupKey hashes a page so that identical pages from the same channel map
+// to the same PagerDuty incident key.
+func getDedupKey(channelName, serviceName, description string) string {
+  h := sha1.New()
+  h.Write([]byte(strings.ToLower(fmt.Sprintf("%s/%s/%s", channelName, serviceName, description))))
+
+  return fmt.Sprintf("%s-%x", PAGE_CLIENT, h.Sum(nil)[:8])
+}
@@ -0,0 +1,41 @@
+package slackbots
+
+import(
+  "fmt"
+  "testing"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+func TestPagerDutyPageOnlyIntegrationKeys(t *testing.T) {
+  tests := []struct {
+    name string
+    services []ServiceConfig
+    reply string
+  }{
+    {
+      name: "ID only",
+      services: []ServiceConfig{{Name: "api", ID: "PSVC001"}, {Name: "kafka", IntegrationKey: "test-key"}},
+      reply: fmt.Sprintf(TPL_SERVICE_NOT_CONFIGURED, "api", "ops", "kafka"),
+    },
+    {
+      name: "none pageable",
+      services: []ServiceConfig{{Name: "api", ID: "PSVC001"}},
+      reply: fmt.Sprintf(TPL_NO_PAGEABLE_SERVICES, "ops"),
+    },
+  }
+  defer configurePagerDuty(pagerDutyConfig)
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      configurePagerDuty(PagerDutyConfig{
+        Channels: []ChannelConfig{{Name: "ops", ID: "C0TEST", Services: test.services}},
+      })
+      slack, bot := newFakeSlack()
+      defer slack.close()
+
+      msg := slackbot.Message{ChannelID: "C0TEST", ChannelName: "ops", UserID: TEST_USER_ID, Text: "?page api it's down"}
+      PagerDutyPage(bot, msg, "api", "it's", "down")
+      slack.expectReply(t, test.reply)
+    })
+  }
+}
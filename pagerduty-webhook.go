@@ -0,0 +1,178 @@
+package slackbots
+
+import(
+  "crypto/subtle"
+  "encoding/json"
+  "fmt"
+  "log"
+  "net/http"
+
+  "github.com/premshree/slackbots/slackbot"
+  "github.com/PagerDuty/go-pagerduty"
+  "github.com/nlopes/slack"
+)
+
+const (
+  WEBHOOK_MAX_BODY_BYTES = 1 << 20 // PagerDuty batches at most 100 small messages
+  TPL_WEBHOOK_TRIGGERED = ":rotating_light: Triggered #%d on %s: %s (assigned to %s) %s"
+  TPL_WEBHOOK_ACKNOWLEDGED = ":eyes: Acknowledged #%d on %s by %s: %s"
+  TPL_WEBHOOK_RESOLVED = ":white_check_mark: Resolved #%d on %s by %s: %s"
+)
+
+// webhookMessages is the body PagerDuty POSTs for v1 webhooks, a batch of
+// messages.
+type webhookMessages struct {
+  Messages []pagerduty.WebhookPayload `json:"messages"`
+}
+
+// webhookIncident is the "incident" in a webhook message's data. The vendored
+// pagerduty.IncidentDetail models service and assigned_to as strings, but
+// PagerDuty sends objects, so we decode just what we render.
+type webhookIncident struct {
+  ID string `json:"id"`
+  IncidentNumber uint `json:"incident_number"`
+  Status string `json:"status"`
+  HTMLURL string `json:"html_url"`
+  Service webhookObject `json:"service"`
+  EscalationPolicy webhookObject `json:"escalation_policy"`
+  AssignedToUser *webhookObject `json:"assigned_to_user"`
+  LastStatusChangeBy *webhookObject `json:"last_status_change_by"`
+  ResolvedByUser *webhookObject `json:"resolved_by_user"`
+  TriggerSummaryData struct {
+    Subject string `json:"subject"`
+    Description string `json:"description"`
+  } `json:"trigger_summary_data"`
+}
+
+type webhookObject struct {
+  ID string `json:"id"`
+  Name string `json:"name"`
+  Email string `json:"email"`
+  HTMLURL string `json:"html_url"`
+}
+
+// PagerDutyWebhook returns an http.HandlerFunc that accepts PagerDuty webhooks
+// and posts trigger, acknowledge and resolve notifications to every channel
+// configured with the incident's escalation policy. The webhook URL in
+// PagerDuty must carry the configured webhook_secret, e.g.
+// https://omnibot.example.com/pagerduty?secret=..., and requests without it
+// are refused. The payloads recorded in testdata/pagerduty-webhooks are
+// replayed by the tests.
+func PagerDutyWebhook(bot *slackbot.Bot) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+      http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+      return
+    }
+    if !isWebhookSecretValid(r.URL.Query().Get("secret")) {
+      log.Printf("Refused a PagerDuty webhook from %s without a valid secret", r.RemoteAddr)
+      http.Error(w, "forbidden", http.StatusForbidden)
+      return
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, WEBHOOK_MAX_BODY_BYTES)
+    var body webhookMessages
+    if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+      log.Printf("Error decoding PagerDuty webhook: %v", err)
+      http.Error(w, "invalid webhook payload", http.StatusBadRequest)
+      return
+    }
+
+    for _, message := range body.Messages {
+      handleWebhookMessage(bot, message)
+    }
+    w.WriteHeader(http.StatusNoContent)
+  }
+}
+
+// isWebhookSecretValid compares in constant time, so the secret can't be
+// guessed a byte at a time. Without a configured secret nothing is valid.
+func isWebhookSecretValid(secret string) bool {
+  expected := pagerDutyConfig.WebhookSecret
+  if expected == "" {
+    return false
+  }
+
+  return subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+}
+
+func handleWebhookMessage(bot *slackbot.Bot, message pagerduty.WebhookPayload) {
+  if message.Data == nil {
+    return
+  }
+  var data struct {
+    Incident webhookIncident `json:"incident"`
+  }
+  if err := json.Unmarshal(*message.Data, &data); err != nil {
+    log.Printf("Error decoding incident in PagerDuty webhook %s: %v", message.ID, err)
+    return
+  }
+  incident := data.Incident
+  summary := incident.TriggerSummaryData.Subject
+  if summary == "" {
+    summary = incident.TriggerSummaryData.Description
+  }
+
+  var reply string
+  switch message.Type {
+  case "incident.trigger":
+    reply = fmt.Sprintf(TPL_WEBHOOK_TRIGGERED, incident.IncidentNumber, incident.Service.Name, summary, getWebhookUserName(incident.AssignedToUser), incident.HTMLURL)
+  case "incident.acknowledge":
+    reply = fmt.Sprintf(TPL_WEBHOOK_ACKNOWLEDGED, incident.IncidentNumber, incident.Service.Name, getWebhookUserName(incident.LastStatusChangeBy), summary)
+  case "incident.resolve":
+    resolvedBy := incident.ResolvedByUser
+    if resolvedBy == nil {
+      resolvedBy = incident.LastStatusChangeBy
+    }
+    reply = fmt.Sprintf(TPL_WEBHOOK_RESOLVED, incident.IncidentNumber, incident.Service.Name, getWebhookUserName(resolvedBy), summary)
+  default:
+    return
+  }
+
+  for _, channelConfig := range channelConfigMap {
+    if !hasEscalationPolicy(channelConfig, incident.EscalationPolicy.ID) {
+      continue
+    }
+    channelID, ok := getConfiguredChannelID(bot, channelConfig)
+    if !ok {
+      log.Printf("No Slack channel %q (id %q) for PagerDuty webhook %s", channelConfig.Name, channelConfig.ID, message.ID)
+      continue
+    }
+    bot.Reply(channelID, reply)
+  }
+}
+
+func hasEscalationPolicy(channelConfig ChannelConfig, escalationPolicyID string) bool {
+  for _, id := range getEscalationPolicyIDs(channelConfig) {
+    if id == escalationPolicyID {
+      return true
+    }
+  }
+
+  return false
+}
+
+func getWebhookUserName(user *webhookObject) string {
+  if user == nil || user.Name == "" {
+    return "nobody"
+  }
+
+  return user.Name
+}
+
+// getChannelID looks up a public or private channel's ID by its name.
+func getChannelID(bot *slackbot.Bot, channelName string) (string, bool) {
+  for id, channel := range bot.Channels() {
+    switch v := channel.(type) {
+    case slack.Channel:
+      if v.Name == channelName {
+        return id, true
+      }
+    case slack.Group:
+      if v.Name == channelName {
+        return id, true
+      }
+    }
+  }
+
+  return "", false
+}
@@ -0,0 +1,90 @@
+package slackbots
+
+import(
+  "bytes"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+)
+
+const PAGERDUTY_WEBHOOKS_DIR = "testdata/pagerduty-webhooks"
+
+func TestPagerDutyWebhook(t *testing.T) {
+  want := map[string]string{
+    "incident.trigger.json": ":rotating_light: Triggered #1234 on api: API 5xx rate above 5% (assigned to Premshree Pillai) https://example.pagerduty.com/incidents/PT4KHLK",
+    "incident.acknowledge.json": ":eyes: Acknowledged #1234 on api by Premshree Pillai: API 5xx rate above 5%",
+    "incident.resolve.json": ":white_check_mark: Resolved #1234 on api by Premshree Pillai: API 5xx rate above 5%",
+  }
+  defer configurePagerDuty(pagerDutyConfig)
+  configurePagerDuty(PagerDutyConfig{
+    Token: "test-token",
+    WebhookSecret: "test-secret",
+    Channels: []ChannelConfig{{Name: "ops", ID: "C0TEST", EscalationPolicyID: "your-escalation-id"}},
+  })
+
+  files, err := ioutil.ReadDir(PAGERDUTY_WEBHOOKS_DIR)
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, file := range files {
+    t.Run(file.Name(), func(t *testing.T) {
+      reply, ok := want[file.Name()]
+      if !ok {
+        t.Fatalf("no expected reply for %s", file.Name())
+      }
+      payload, err := ioutil.ReadFile(filepath.Join(PAGERDUTY_WEBHOOKS_DIR, file.Name()))
+      if err != nil {
+        t.Fatal(err)
+      }
+      slack, bot := newFakeSlack()
+      defer slack.close()
+
+      req := httptest.NewRequest("POST", "/pagerduty?secret=test-secret", bytes.NewReader(payload))
+      w := httptest.NewRecorder()
+      PagerDutyWebhook(bot)(w, req)
+      if w.Code != http.StatusNoContent {
+        t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+      }
+      slack.expectReply(t, reply)
+    })
+  }
+}
+
+func TestPagerDutyWebhookSecret(t *testing.T) {
+  payload, err := ioutil.ReadFile(filepath.Join(PAGERDUTY_WEBHOOKS_DIR, "incident.trigger.json"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct {
+    name string
+    configured string
+    secret string
+  }{
+    {"wrong secret", "test-secret", "guess"},
+    {"no secret", "test-secret", ""},
+    {"not configured", "", ""},
+  }
+  defer configurePagerDuty(pagerDutyConfig)
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      configurePagerDuty(PagerDutyConfig{
+        WebhookSecret: test.configured,
+        Channels: []ChannelConfig{{Name: "ops", ID: "C0TEST", EscalationPolicyID: "your-escalation-id"}},
+      })
+      slack, bot := newFakeSlack()
+      defer slack.close()
+
+      req := httptest.NewRequest("POST", "/pagerduty?secret=" + test.secret, bytes.NewReader(payload))
+      w := httptest.NewRecorder()
+      PagerDutyWebhook(bot)(w, req)
+      if w.Code != http.StatusForbidden {
+        t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+      }
+      if replies := slack.getReplies(); len(replies) != 0 {
+        t.Errorf("replies = %q, want none", replies)
+      }
+    })
+  }
+}
@@ -0,0 +1,73 @@
+package slackbots
+
+import(
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "sync"
+  "testing"
+
+  "github.com/nlopes/slack"
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const TEST_USER_ID = "U0TEST"
+
+// fakeSlack stands in for the Slack Web API, recording what the bot posts.
+type fakeSlack struct {
+  server *httptest.Server
+  slackAPI string
+  mutex sync.Mutex
+  replies []string
+}
+
+// newFakeSlack points the slack package at a fake Slack and returns a bot
+// that talks to it. Call close when done.
+func newFakeSlack() (*fakeSlack, *slackbot.Bot) {
+  fake := &fakeSlack{slackAPI: slack.SLACK_API}
+  fake.server = httptest.NewServer(http.HandlerFunc(fake.handle))
+  slack.SLACK_API = fake.server.URL + "/"
+
+  return fake, slackbot.New("xoxb-test")
+}
+
+func (f *fakeSlack) handle(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Content-Type", "application/json")
+  switch r.URL.Path {
+  case "/chat.postMessage":
+    f.mutex.Lock()
+    f.replies = append(f.replies, r.FormValue("text"))
+    f.mutex.Unlock()
+    fmt.Fprintf(w, `{"ok":true,"channel":%q,"ts":"1500000000.000100"}`, r.FormValue("channel"))
+  case "/users.list":
+    fmt.Fprintf(w, `{"ok":true,"members":[{"id":%q,"name":"tester"}]}`, TEST_USER_ID)
+  case "/channels.list":
+    fmt.Fprint(w, `{"ok":true,"channels":[{"id":"C0TEST","name":"ops"}]}`)
+  case "/groups.list":
+    fmt.Fprint(w, `{"ok":true,"groups":[]}`)
+  default:
+    fmt.Fprint(w, `{"ok":true}`)
+  }
+}
+
+// getReplies returns everything the bot has posted so far.
+func (f *fakeSlack) getReplies() []string {
+  f.mutex.Lock()
+  defer f.mutex.Unlock()
+
+  return append([]string{}, f.replies...)
+}
+
+// expectReply fails the test unless the bot has posted exactly one reply,
+// and it's want.
+func (f *fakeSlack) expectReply(t *testing.T, want string) {
+  replies := f.getReplies()
+  if len(replies) != 1 || replies[0] != want {
+    t.Errorf("replies = %q, want [%q]", replies, want)
+  }
+}
+
+func (f *fakeSlack) close() {
+  slack.SLACK_API = f.slackAPI
+  f.server.Close()
+}
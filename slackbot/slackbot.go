@@ -0,0 +1,346 @@
+// Package slackbot is github.com/premshree/lib-slackbot grown to what the
+// commands here need: the calling Message, listeners, threads and channel
+// lookups. It lives in this repo rather than being patched under vendor/.
+package slackbot
+
+import(
+  "encoding/json"
+  "fmt"
+  "log"
+  "net/http"
+  "net/url"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/nlopes/slack"
+)
+
+const (
+  HELP = "help"
+  API_TIMEOUT = 10 // seconds, for the calls the slack package doesn't make
+  REPLIES_PAGE_SIZE = 200
+)
+
+type Bot struct {
+  token string
+  api *slack.Client
+  commands map[string]command
+  listeners []listenerFn
+}
+
+type command struct {
+  Name string
+  Description string
+  Callback fn
+  MessageCallback messageFn
+}
+
+// Message describes the Slack message that invoked a command
+type Message struct {
+  ChannelID string
+  ChannelName string
+  UserID string
+  Text string
+  Timestamp string
+  ThreadTimestamp string
+}
+
+type fn func(*Bot, string, string, ...string)
+
+type messageFn func(*Bot, Message, ...string)
+
+type listenerFn func(*Bot, Message)
+
+var (
+  // Loaded once, then only read, so readers can keep what they get
+  mapsMutex sync.RWMutex
+  channelsMap map[string]interface{}
+  usersMap map[string]string
+  teamDomainMutex sync.Mutex
+  teamDomain string
+  textUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+)
+
+// Initializes a new slackbot
+func New(slackToken string) *Bot {
+  return &Bot{
+    token: slackToken,
+    api: slack.New(slackToken),
+    commands: map[string]command{ },
+  }
+}
+
+// AddCommand lets you add a command that your slack bot can respond to. It passes back
+// the bot (*slackbot.Bot), a channel ID (string), a channel (string).
+func (b *Bot) AddCommand(message, description string, callback fn) {
+  b.commands[message] = command{
+    Name: message,
+    Description: description,
+    Callback: callback,
+  };
+}
+
+// AddMessageCommand is like AddCommand, but the callback receives the full Message
+// that invoked the command, including the user who sent it.
+func (b *Bot) AddMessageCommand(message, description string, callback messageFn) {
+  b.commands[message] = command{
+    Name: message,
+    Description: description,
+    MessageCallback: callback,
+  }
+}
+
+// AddListener registers a callback for every message people post that isn't a
+// command, e.g. to react to keywords. Bot messages and edits are skipped.
+func (b *Bot) AddListener(callback listenerFn) {
+  b.listeners = append(b.listeners, callback)
+}
+
+// Once you add commands to your bot, you need to call Run() so your bot can start
+// listening to commands
+func (b *Bot) Run() {
+  rtm := b.api.NewRTM()
+  go rtm.ManageConnection()
+
+  b.Channels()
+  b.Users()
+
+  for msg := range rtm.IncomingEvents {
+    switch ev := msg.Data.(type) {
+    case *slack.MessageEvent:
+      go b.handleMessage(ev.Msg)
+    case *slack.RTMError:
+      log.Printf("Error: %s\n", ev.Error())
+    default:
+    }
+  }
+}
+
+// A handy function you can use within your AddCommand callbacks so the bot
+// can reply to commands
+func (b *Bot) Reply(channel string, reply string) {
+  _, _, err := b.api.PostMessage(channel, reply, slack.PostMessageParameters{})
+  if err != nil {
+    log.Printf("Error replying to %s: %v", channel, err)
+  }
+}
+
+// ReplyInThread is like Reply, but replies in the thread started by the
+// message with timestamp threadTimestamp.
+func (b *Bot) ReplyInThread(channel string, threadTimestamp string, reply string) {
+  params := slack.PostMessageParameters{ThreadTimestamp: threadTimestamp}
+  _, _, err := b.api.PostMessage(channel, reply, params)
+  if err != nil {
+    log.Printf("Error replying in thread %s on %s: %v", threadTimestamp, channel, err)
+  }
+}
+
+// ThreadReplies returns the messages in a thread, starting with the message
+// that started it, in a public or private channel or a DM. Their text is
+// unescaped like a command's.
+func (b *Bot) ThreadReplies(channel string, threadTimestamp string) ([]slack.Message, error) {
+  var replies []slack.Message
+  cursor := ""
+  for {
+    page, next, err := b.getConversationReplies(channel, threadTimestamp, cursor)
+    if err != nil {
+      return nil, err
+    }
+    replies = append(replies, page...)
+    if next == "" {
+      break
+    }
+    cursor = next
+  }
+  for i := range replies {
+    replies[i].Text = unescapeText(replies[i].Text)
+  }
+
+  return replies, nil
+}
+
+// getConversationReplies calls conversations.replies, which the slack package
+// doesn't have, returning a page of replies and the cursor for the next.
+func (b *Bot) getConversationReplies(channel string, threadTimestamp string, cursor string) ([]slack.Message, string, error) {
+  values := url.Values{
+    "token": {b.token},
+    "channel": {channel},
+    "ts": {threadTimestamp},
+    "limit": {fmt.Sprintf("%d", REPLIES_PAGE_SIZE)},
+  }
+  if cursor != "" {
+    values.Set("cursor", cursor)
+  }
+  client := &http.Client{
+    Timeout: time.Duration(API_TIMEOUT * time.Second),
+  }
+  resp, err := client.PostForm(slack.SLACK_API + "conversations.replies", values)
+  if err != nil {
+    return nil, "", err
+  }
+  defer resp.Body.Close()
+
+  var body struct {
+    Ok bool `json:"ok"`
+    Error string `json:"error"`
+    Messages []slack.Message `json:"messages"`
+    ResponseMetadata struct {
+      NextCursor string `json:"next_cursor"`
+    } `json:"response_metadata"`
+  }
+  if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+    return nil, "", err
+  }
+  if !body.Ok {
+    return nil, "", fmt.Errorf("conversations.replies: %s", body.Error)
+  }
+
+  return body.Messages, body.ResponseMetadata.NextCursor, nil
+}
+
+// Permalink returns a link to the message with timestamp ts in channel.
+func (b *Bot) Permalink(channel string, ts string) (string, error) {
+  teamDomainMutex.Lock()
+  defer teamDomainMutex.Unlock()
+  if teamDomain == "" {
+    team, err := b.api.GetTeamInfo()
+    if err != nil {
+      return "", err
+    }
+    teamDomain = team.Domain
+  }
+
+  return fmt.Sprintf("https://%s.slack.com/archives/%s/p%s", teamDomain, channel, strings.Replace(ts, ".", "", 1)), nil
+}
+
+// API returns the underlying Slack client, for anything the bot doesn't wrap.
+func (b *Bot) API() *slack.Client {
+  return b.api
+}
+
+func (b *Bot) handleMessage(msg slack.Msg) {
+  // A command that panics shouldn't take down every other command with it
+  defer func() {
+    if r := recover(); r != nil {
+      log.Printf("Recovered from panic handling %q: %v", msg.Text, r)
+    }
+  }()
+  msg.Text = unescapeText(msg.Text)
+  messageSlice := strings.Split(msg.Text, " ")
+  command := messageSlice[0]
+  channelID := msg.Channel
+  var channelName string
+  switch v := b.Channels()[channelID].(type) {
+  case slack.Channel:
+    channelName = v.Name
+  case slack.Group:
+    channelName = v.Name
+  }
+  var args []string
+  if len(messageSlice) > 1 {
+    args = messageSlice[1:]
+  }
+  message := Message{
+    ChannelID: channelID,
+    ChannelName: channelName,
+    UserID: msg.User,
+    Text: msg.Text,
+    Timestamp: msg.Timestamp,
+    ThreadTimestamp: msg.ThreadTimestamp,
+  }
+  if _, ok := b.commands[command]; ok {
+    log.Printf("♔ %s on #%s by @%s", command, channelName, b.Users()[msg.User])
+    if args != nil && args[0] == HELP {
+      b.Reply(channelID, b.commands[command].Description)
+    } else if b.commands[command].MessageCallback != nil {
+      b.commands[command].MessageCallback(b, message, args...)
+    } else {
+      b.commands[command].Callback(b, channelID, channelName, args...)
+    }
+    return
+  }
+  if msg.SubType != "" || msg.BotID != "" {
+    return
+  }
+  for _, listener := range b.listeners {
+    listener(b, message)
+  }
+}
+
+// unescapeText undoes the escaping Slack does to &, < and > in message text,
+// so e.g. ?jira search created >= -7d reaches the command as typed. Mentions
+// and links like <@U024BE7LH> use real angle brackets and are left alone.
+func unescapeText(text string) string {
+  return textUnescaper.Replace(text)
+}
+
+// Users returns everyone's Slack username, keyed by user ID.
+func (b *Bot) Users() map[string]string {
+  mapsMutex.RLock()
+  users := usersMap
+  mapsMutex.RUnlock()
+  if users != nil {
+    return users
+  }
+
+  mapsMutex.Lock()
+  defer mapsMutex.Unlock()
+  if usersMap == nil {
+    usersMap = b.getAllUsers()
+  }
+
+  return usersMap
+}
+
+// Channels returns the public and private channels the bot can see, keyed by
+// channel ID. Values are slack.Channel or slack.Group.
+func (b *Bot) Channels() map[string]interface{} {
+  mapsMutex.RLock()
+  channels := channelsMap
+  mapsMutex.RUnlock()
+  if channels != nil {
+    return channels
+  }
+
+  mapsMutex.Lock()
+  defer mapsMutex.Unlock()
+  if channelsMap == nil {
+    channelsMap = b.getAllChannels()
+  }
+
+  return channelsMap
+}
+
+func (b *Bot) getAllChannels() map[string]interface{} {
+  allChannels, err := b.api.GetChannels(true)
+  if err != nil {
+    log.Fatalf("Uh oh, error fetching channels: %v", err)
+  }
+  allGroups, err := b.api.GetGroups(true)
+  if err != nil {
+    log.Fatalf("Uh oh, error fetching private channels %v", err)
+  }
+  channelsMap := make(map[string]interface{})
+  for _, channel := range allChannels {
+    channelsMap[channel.ID] = channel
+  }
+  for _, group := range allGroups {
+    channelsMap[group.ID] = group
+  }
+
+  return channelsMap
+}
+
+func (b *Bot) getAllUsers() map[string]string {
+  allUsers, err := b.api.GetUsers()
+  if err != nil {
+    log.Fatalf("Uh oh, error fetching users: %v", err)
+  }
+  usersMap := make(map[string]string)
+  for _, user := range allUsers {
+    usersMap[user.ID] = user.Name
+  }
+
+  return usersMap
+}
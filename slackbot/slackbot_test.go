@@ -0,0 +1,79 @@
+package slackbot
+
+import(
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "reflect"
+  "testing"
+
+  "github.com/nlopes/slack"
+)
+
+func TestHandleMessageUnescapesText(t *testing.T) {
+  mapsMutex.Lock()
+  channelsMap = map[string]interface{}{"C0TEST": slack.Channel{}}
+  usersMap = map[string]string{"U0TEST": "tester"}
+  mapsMutex.Unlock()
+
+  tests := []struct {
+    text string
+    args []string
+  }{
+    {"?jira search created &gt;= -7d", []string{"search", "created", ">=", "-7d"}},
+    {"?jira search priority &lt; High", []string{"search", "priority", "<", "High"}},
+    {"?page api R&amp;D is down", []string{"api", "R&D", "is", "down"}},
+    {"?page api &amp;lt; stays escaped once", []string{"api", "&lt;", "stays", "escaped", "once"}},
+    {"?page api ask <@U0TEST>", []string{"api", "ask", "<@U0TEST>"}},
+  }
+  for _, test := range tests {
+    var got []string
+    var gotText string
+    b := New("xoxb-test")
+    callback := func(b *Bot, msg Message, args ...string) {
+      got = args
+      gotText = msg.Text
+    }
+    b.AddMessageCommand("?jira", "", callback)
+    b.AddMessageCommand("?page", "", callback)
+    b.handleMessage(slack.Msg{Channel: "C0TEST", User: "U0TEST", Text: test.text})
+    if !reflect.DeepEqual(got, test.args) {
+      t.Errorf("%q: args = %q, want %q", test.text, got, test.args)
+    }
+    if gotText != unescapeText(test.text) {
+      t.Errorf("%q: text = %q, want it unescaped", test.text, gotText)
+    }
+  }
+}
+
+func TestThreadRepliesInDM(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != "/conversations.replies" || r.FormValue("channel") != "D0TEST" || r.FormValue("ts") != "1500000000.000100" {
+      fmt.Fprintf(w, `{"ok":false,"error":"unexpected %s %s"}`, r.URL.Path, r.Form.Encode())
+      return
+    }
+    switch r.FormValue("cursor") {
+    case "":
+      fmt.Fprint(w, `{"ok":true,"messages":[{"ts":"1500000000.000100","user":"U0TEST","text":"deploys fail &amp; roll back"}],"response_metadata":{"next_cursor":"page2"}}`)
+    case "page2":
+      fmt.Fprint(w, `{"ok":true,"messages":[{"ts":"1500000000.000200","user":"U0TEST","text":"latency &gt; 5s"}],"response_metadata":{"next_cursor":""}}`)
+    }
+  }))
+  defer server.Close()
+  defer func(slackAPI string) {
+    slack.SLACK_API = slackAPI
+  }(slack.SLACK_API)
+  slack.SLACK_API = server.URL + "/"
+
+  replies, err := New("xoxb-test").ThreadReplies("D0TEST", "1500000000.000100")
+  if err != nil {
+    t.Fatal(err)
+  }
+  var texts []string
+  for _, reply := range replies {
+    texts = append(texts, reply.Text)
+  }
+  if want := []string{"deploys fail & roll back", "latency > 5s"}; !reflect.DeepEqual(texts, want) {
+    t.Errorf("replies = %q, want %q", texts, want)
+  }
+}
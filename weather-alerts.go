@@ -0,0 +1,173 @@
+package slackbots
+
+import(
+  "crypto/sha1"
+  "fmt"
+  "log"
+  "net/http"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const (
+  DEFAULT_WEATHER_ALERT_INTERVAL = 15 * time.Minute
+  WEATHER_ALERT_TIME_FORMAT = "Mon Jan 2 3:04pm MST"
+  TPL_WEATHER_ALERT = ":warning: *%s* for %s from %s until %s (%s)\n%s"
+)
+
+// OneCallResponse is the part of OpenWeatherMap's One Call response we ask for.
+type OneCallResponse struct {
+  Timezone string `json:"timezone"`
+  Alerts []WeatherAlert `json:"alerts"`
+}
+
+type WeatherAlert struct {
+  SenderName string `json:"sender_name"`
+  Event string `json:"event"`
+  Start int64 `json:"start"`
+  End int64 `json:"end"`
+  Description string `json:"description"`
+}
+
+type weatherCoordinates struct {
+  Lat float64
+  Lon float64
+  Name string
+}
+
+var (
+  weatherAlertsMutex sync.Mutex
+  postedWeatherAlerts = make(map[string]time.Time) // channel ID/alert ID => alert end
+  weatherCoordinatesCache = make(map[string]weatherCoordinates) // location => coordinates
+  weatherAlertsUnauthorized bool // logged that the token can't use One Call
+)
+
+// WatchWeatherAlerts checks for severe weather at each channel's
+// alert_locations every alert_interval, and posts alerts it hasn't posted to
+// the channel before. It blocks, so run it in a goroutine.
+func WatchWeatherAlerts(bot *slackbot.Bot) {
+  watching := false
+  for _, channelConfig := range weatherConfig.Channels {
+    watching = watching || len(channelConfig.AlertLocations) > 0
+  }
+  if !watching {
+    return
+  }
+  interval := weatherConfig.AlertInterval
+  if interval == 0 {
+    interval = DEFAULT_WEATHER_ALERT_INTERVAL
+  }
+  for {
+    checkWeatherAlerts(bot)
+    time.Sleep(interval)
+  }
+}
+
+func checkWeatherAlerts(bot *slackbot.Bot) {
+  for _, channelConfig := range weatherConfig.Channels {
+    if len(channelConfig.AlertLocations) == 0 {
+      continue
+    }
+    channelID := channelConfig.ID
+    if channelID == "" {
+      var ok bool
+      if channelID, ok = getChannelID(bot, channelConfig.Name); !ok {
+        log.Printf("Not checking weather alerts for #%s, I'm not in it", channelConfig.Name)
+        continue
+      }
+    }
+
+    for _, location := range channelConfig.AlertLocations {
+      coordinates, err := getWeatherCoordinates(location)
+      if err != nil {
+        log.Printf("Error finding %s to check for weather alerts: %v", location, err)
+        continue
+      }
+      oneCall, err := weatherClient.Alerts(coordinates.Lat, coordinates.Lon)
+      if owmErr, ok := err.(*OpenWeatherMapError); ok && owmErr.StatusCode == http.StatusUnauthorized {
+        // It'll be the same on every poll until the subscription changes
+        weatherAlertsMutex.Lock()
+        if !weatherAlertsUnauthorized {
+          log.Printf("Can't check weather alerts, the OpenWeatherMap token needs a One Call 3.0 subscription: %v", err)
+        }
+        weatherAlertsUnauthorized = true
+        weatherAlertsMutex.Unlock()
+        continue
+      } else if err != nil {
+        log.Printf("Error checking weather alerts for %s: %v", location, err)
+        continue
+      }
+      weatherAlertsMutex.Lock()
+      weatherAlertsUnauthorized = false
+      weatherAlertsMutex.Unlock()
+      zone, err := time.LoadLocation(oneCall.Timezone)
+      if err != nil {
+        zone = time.UTC
+      }
+      for _, alert := range oneCall.Alerts {
+        if shouldPostWeatherAlert(channelID, alert) {
+          bot.Reply(channelID, formatWeatherAlert(coordinates.Name, zone, alert))
+        }
+      }
+    }
+  }
+}
+
+// getWeatherCoordinates looks up a location's coordinates, which One Call
+// needs, once.
+func getWeatherCoordinates(location string) (weatherCoordinates, error) {
+  weatherAlertsMutex.Lock()
+  coordinates, ok := weatherCoordinatesCache[location]
+  weatherAlertsMutex.Unlock()
+  if ok {
+    return coordinates, nil
+  }
+
+  weather, err := weatherClient.CurrentWeather(location, WEATHER_UNITS_STANDARD)
+  if err != nil {
+    return coordinates, err
+  }
+  coordinates = weatherCoordinates{Lat: weather.Coord.Lat, Lon: weather.Coord.Lon, Name: weather.Name}
+  weatherAlertsMutex.Lock()
+  weatherCoordinatesCache[location] = coordinates
+  weatherAlertsMutex.Unlock()
+
+  return coordinates, nil
+}
+
+// shouldPostWeatherAlert reports whether alert is new to the channel, and if
+// so remembers it until it ends. Alerts are posted again after a restart.
+func shouldPostWeatherAlert(channelID string, alert WeatherAlert) bool {
+  id := channelID + "/" + getWeatherAlertID(alert)
+
+  weatherAlertsMutex.Lock()
+  defer weatherAlertsMutex.Unlock()
+  for posted, end := range postedWeatherAlerts {
+    if time.Now().After(end) {
+      delete(postedWeatherAlerts, posted)
+    }
+  }
+  if _, ok := postedWeatherAlerts[id]; ok {
+    return false
+  }
+  postedWeatherAlerts[id] = time.Unix(alert.End, 0)
+
+  return true
+}
+
+// getWeatherAlertID identifies an alert, which One Call doesn't do for us, by
+// who sent it, what it's for and when it starts. Updates to an alert that
+// change any of those count as a new alert.
+func getWeatherAlertID(alert WeatherAlert) string {
+  return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d", alert.SenderName, alert.Event, alert.Start))))
+}
+
+func formatWeatherAlert(location string, zone *time.Location, alert WeatherAlert) string {
+  start := time.Unix(alert.Start, 0).In(zone).Format(WEATHER_ALERT_TIME_FORMAT)
+  end := time.Unix(alert.End, 0).In(zone).Format(WEATHER_ALERT_TIME_FORMAT)
+
+  return fmt.Sprintf(TPL_WEATHER_ALERT, alert.Event, location, start, end, alert.SenderName, strings.TrimSpace(alert.Description))
+}
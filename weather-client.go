@@ -0,0 +1,157 @@
+package slackbots
+
+import(
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "strings"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const (
+  DEFAULT_OWM_BASE_URL = "https://api.openweathermap.org"
+  OWM_ONECALL_PATH = "/data/3.0/onecall"
+  OWM_REQUEST_TIMEOUT = 5 // seconds
+  TPL_WEATHER_RATE_LIMITED = "I've asked for the weather too often, try again in a minute"
+)
+
+// OpenWeatherMapClient calls the OpenWeatherMap API at BaseURL, which is
+// DEFAULT_OWM_BASE_URL unless the config points it elsewhere. The weather and
+// forecast come from the free 2.5 API, and alerts from One Call 3.0, which
+// needs its own subscription on the token.
+type OpenWeatherMapClient struct {
+  BaseURL string
+  Token string
+  HTTPClient *http.Client
+}
+
+// OpenWeatherMapError is a non-200 response, e.g.
+// {"cod":"404","message":"city not found"}
+type OpenWeatherMapError struct {
+  StatusCode int
+  Message string `json:"message"`
+}
+
+func (e *OpenWeatherMapError) Error() string {
+  return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func NewOpenWeatherMapClient(baseURL string, token string) *OpenWeatherMapClient {
+  if baseURL == "" {
+    baseURL = DEFAULT_OWM_BASE_URL
+  }
+
+  return &OpenWeatherMapClient{
+    BaseURL: strings.TrimRight(baseURL, "/"),
+    Token: token,
+    HTTPClient: &http.Client{
+      Timeout: time.Duration(OWM_REQUEST_TIMEOUT * time.Second),
+    },
+  }
+}
+
+// CurrentWeather returns the weather at location, in units.
+func (c *OpenWeatherMapClient) CurrentWeather(location string, units string) (WeatherResponse, error) {
+  var weather WeatherResponse
+  if err := c.get("/data/2.5/weather", getWeatherLocationParams(location), units, &weather); err != nil {
+    return weather, err
+  }
+  if weather.Name == "" && len(weather.Weather) == 0 {
+    return weather, fmt.Errorf("malformed weather for %s: no location or conditions", location)
+  }
+
+  return weather, nil
+}
+
+// Forecast returns the 5 day forecast at location, in units.
+func (c *OpenWeatherMapClient) Forecast(location string, units string) (ForecastResponse, error) {
+  var forecast ForecastResponse
+  if err := c.get("/data/2.5/forecast", getWeatherLocationParams(location), units, &forecast); err != nil {
+    return forecast, err
+  }
+  if len(forecast.List) == 0 {
+    return forecast, fmt.Errorf("malformed forecast for %s: no steps", location)
+  }
+
+  return forecast, nil
+}
+
+// Alerts returns the government weather alerts in effect at lat, lon, from
+// the One Call 3.0 API. Without a One Call subscription it's a 401.
+func (c *OpenWeatherMapClient) Alerts(lat float64, lon float64) (OneCallResponse, error) {
+  params := url.Values{}
+  params.Set("lat", fmt.Sprintf("%f", lat))
+  params.Set("lon", fmt.Sprintf("%f", lon))
+  params.Set("exclude", "current,minutely,hourly,daily")
+  var oneCall OneCallResponse
+  err := c.get(OWM_ONECALL_PATH, params, WEATHER_UNITS_STANDARD, &oneCall)
+
+  return oneCall, err
+}
+
+func (c *OpenWeatherMapClient) get(path string, params url.Values, units string, out interface{}) error {
+  params.Set("units", units)
+  params.Set("appid", c.Token)
+  rs, err := c.HTTPClient.Get(c.BaseURL + path + "?" + params.Encode())
+  if err != nil {
+    return err
+  }
+  defer rs.Body.Close()
+
+  body, err := ioutil.ReadAll(rs.Body)
+  if err != nil {
+    return err
+  }
+  if rs.StatusCode != http.StatusOK {
+    owmErr := &OpenWeatherMapError{StatusCode: rs.StatusCode}
+    // The message is a nicety, the status is what matters
+    json.Unmarshal(body, owmErr)
+    return owmErr
+  }
+  if err := json.Unmarshal(body, out); err != nil {
+    return fmt.Errorf("malformed response from %s: %v", path, err)
+  }
+
+  return nil
+}
+
+// getWeatherLocationParams turns a location given as lat,lon, a postal code
+// with an optional country (US if there isn't one), or a place name like
+// "San Francisco" or "Paris,FR" into query parameters.
+func getWeatherLocationParams(location string) url.Values {
+  params := url.Values{}
+  if matches := weatherCoordinatesPattern.FindStringSubmatch(location); matches != nil {
+    params.Set("lat", matches[1])
+    params.Set("lon", matches[2])
+  } else if matches := weatherPostalCodePattern.FindStringSubmatch(location); matches != nil {
+    zip := strings.TrimSpace(matches[1])
+    if matches[2] != "" {
+      zip += "," + strings.ToUpper(matches[2])
+    }
+    params.Set("zip", zip)
+  } else {
+    params.Set("q", location)
+  }
+
+  return params
+}
+
+// replyWeatherError tells the user when the location doesn't exist or
+// we're rate limited, and is replyError otherwise.
+func replyWeatherError(bot *slackbot.Bot, channelID string, err error, location string, action string) {
+  if owmErr, ok := err.(*OpenWeatherMapError); ok {
+    switch owmErr.StatusCode {
+    case http.StatusNotFound:
+      bot.Reply(channelID, fmt.Sprintf(TPL_WEATHER_NOT_FOUND, location))
+      return
+    case http.StatusTooManyRequests:
+      bot.Reply(channelID, TPL_WEATHER_RATE_LIMITED)
+      return
+    }
+  }
+  replyError(bot, channelID, err, "%s %s", action, location)
+}
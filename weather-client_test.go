@@ -0,0 +1,81 @@
+package slackbots
+
+import(
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestOpenWeatherMapClientErrors(t *testing.T) {
+  tests := []struct {
+    name string
+    status int
+    body string
+    weatherErr string
+    forecastErr string
+    reply string
+  }{
+    {
+      name: "not found",
+      status: http.StatusNotFound,
+      body: `{"cod":"404","message":"city not found"}`,
+      weatherErr: "404 Not Found: city not found",
+      forecastErr: "404 Not Found: city not found",
+      reply: fmt.Sprintf(TPL_WEATHER_NOT_FOUND, "Atlantis"),
+    },
+    {
+      name: "rate limited",
+      status: http.StatusTooManyRequests,
+      body: `{"cod":429,"message":"Your account is temporary blocked due to exceeding of requests limitation of your subscription type."}`,
+      weatherErr: "429 Too Many Requests",
+      forecastErr: "429 Too Many Requests",
+      reply: TPL_WEATHER_RATE_LIMITED,
+    },
+    {
+      name: "not JSON",
+      status: http.StatusOK,
+      body: "<html><body>502 Bad Gateway</body></html>",
+      weatherErr: "malformed response from /data/2.5/weather",
+      forecastErr: "malformed response from /data/2.5/forecast",
+      reply: "Sorry, I ran into a problem getting the weather for Atlantis :disappointed:",
+    },
+    {
+      name: "empty",
+      status: http.StatusOK,
+      body: `{}`,
+      weatherErr: "malformed weather for Atlantis",
+      forecastErr: "malformed forecast for Atlantis",
+      reply: "Sorry, I ran into a problem getting the weather for Atlantis :disappointed:",
+    },
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      owm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(test.status)
+        fmt.Fprint(w, test.body)
+      }))
+      defer owm.Close()
+      client := NewOpenWeatherMapClient(owm.URL, "test-token")
+
+      _, weatherErr := client.CurrentWeather("Atlantis", WEATHER_UNITS_METRIC)
+      if weatherErr == nil || !strings.Contains(weatherErr.Error(), test.weatherErr) {
+        t.Errorf("CurrentWeather error = %v, want %q", weatherErr, test.weatherErr)
+      }
+      _, forecastErr := client.Forecast("Atlantis", WEATHER_UNITS_METRIC)
+      if forecastErr == nil || !strings.Contains(forecastErr.Error(), test.forecastErr) {
+        t.Errorf("Forecast error = %v, want %q", forecastErr, test.forecastErr)
+      }
+      if weatherErr == nil {
+        return
+      }
+
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      replyWeatherError(bot, "C0TEST", weatherErr, "Atlantis", "getting the weather for")
+      slack.expectReply(t, test.reply)
+    })
+  }
+}
@@ -0,0 +1,99 @@
+package slackbots
+
+import(
+  "bytes"
+  "fmt"
+  "math"
+  "time"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+const (
+  WEATHER_MODE_FORECAST = "forecast"
+  WEATHER_MODE_TOMORROW = "tomorrow"
+  WEATHER_DAY_FORMAT = "Mon Jan 2"
+  TPL_WEATHER_FORECAST_DAY = "%s: %s, high %s, low %s, %d%% chance of precipitation\n"
+)
+
+// ForecastResponse is OpenWeatherMap's 5 day forecast, in 3 hour steps.
+type ForecastResponse struct {
+  List []ForecastStep `json:"list"`
+  City ForecastCity `json:"city"`
+}
+
+type ForecastStep struct {
+  Dt int64 `json:"dt"`
+  Main struct {
+    TempMin float64 `json:"temp_min"`
+    TempMax float64 `json:"temp_max"`
+  } `json:"main"`
+  Weather []WeatherCondition `json:"weather"`
+  Pop float64 `json:"pop"` // probability of precipitation, 0 to 1
+}
+
+type ForecastCity struct {
+  Name string `json:"name"`
+  Timezone int `json:"timezone"` // seconds from UTC
+}
+
+// forecastDay summarizes a day's steps.
+type forecastDay struct {
+  Date time.Time
+  High float64
+  Low float64
+  Pop float64
+  Description string
+}
+
+// weatherForecast replies with the next few days, or just tomorrow, at location.
+func weatherForecast(bot *slackbot.Bot, channelID string, mode string, location string, units string) {
+  forecast, err := weatherClient.Forecast(location, units)
+  if err != nil {
+    replyWeatherError(bot, channelID, err, location, "getting the forecast for")
+    return
+  }
+
+  days := getForecastDays(forecast)
+  if mode == WEATHER_MODE_TOMORROW {
+    // The first day is today, even if there's only a step or two of it left
+    if len(days) < 2 {
+      replyError(bot, channelID, fmt.Errorf("no forecast past today"), "getting tomorrow's forecast for %s", location)
+      return
+    }
+    days = days[1:2]
+  }
+
+  var buffer bytes.Buffer
+  buffer.WriteString(fmt.Sprintf("Forecast for %s:\n", forecast.City.Name))
+  for _, day := range days {
+    buffer.WriteString(fmt.Sprintf(TPL_WEATHER_FORECAST_DAY, day.Date.Format(WEATHER_DAY_FORMAT), day.Description, formatTemperature(day.High, units), formatTemperature(day.Low, units), int(day.Pop * 100)))
+  }
+  bot.Reply(channelID, buffer.String())
+}
+
+// getForecastDays groups the forecast's steps into days, in the location's
+// own time zone. A day's description is the one nearest midday.
+func getForecastDays(forecast ForecastResponse) []forecastDay {
+  location := time.FixedZone(forecast.City.Name, forecast.City.Timezone)
+  var days []forecastDay
+  var middayDistance float64
+  for _, step := range forecast.List {
+    t := time.Unix(step.Dt, 0).In(location)
+    date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+    if len(days) == 0 || !days[len(days) - 1].Date.Equal(date) {
+      days = append(days, forecastDay{Date: date, High: step.Main.TempMax, Low: step.Main.TempMin})
+      middayDistance = math.MaxFloat64
+    }
+    day := &days[len(days) - 1]
+    day.High = math.Max(day.High, step.Main.TempMax)
+    day.Low = math.Min(day.Low, step.Main.TempMin)
+    day.Pop = math.Max(day.Pop, step.Pop)
+    if distance := math.Abs(float64(t.Hour()) - 12); distance < middayDistance && len(step.Weather) > 0 {
+      day.Description = step.Weather[0].Description
+      middayDistance = distance
+    }
+  }
+
+  return days
+}
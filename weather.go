@@ -1,68 +1,213 @@
 package slackbots
 
 import(
-  "encoding/json"
   "fmt"
-  "io/ioutil"
-  "net/http"
+  "math"
+  "regexp"
+  "strings"
+  "time"
 
-  "github.com/premshree/lib-slackbot"
-  "github.com/spf13/viper"
+  "github.com/premshree/slackbots/slackbot"
 )
 
+const (
+  WEATHER_USAGE = "?weather [forecast|tomorrow] [metric|imperial|standard] [zipcode | zipcode,country | city | lat,lon]"
+  WEATHER_COORDINATES_PATTERN = "^(-?[0-9]+(?:\\.[0-9]+)?)\\s*,\\s*(-?[0-9]+(?:\\.[0-9]+)?)$"
+  WEATHER_POSTAL_CODE_PATTERN = "^([A-Za-z0-9 -]*[0-9][A-Za-z0-9 -]*)(?:\\s*,\\s*([A-Za-z]{2}))?$"
+  WEATHER_UNITS_METRIC = "metric"
+  WEATHER_UNITS_IMPERIAL = "imperial"
+  WEATHER_UNITS_STANDARD = "standard" // Kelvin
+  DEFAULT_WEATHER_UNITS = WEATHER_UNITS_IMPERIAL
+  WEATHER_TIME_FORMAT = "3:04pm"
+  TPL_WEATHER = "Weather in %s: %s, %s (feels like %s), %d%% humidity, wind %s %s. Sunrise %s, sunset %s"
+  TPL_WEATHER_NOT_FOUND = "Uh oh, I couldn't find %s. Try a city, zipcode,country or lat,lon"
+  TPL_WEATHER_NO_LOCATION = "Where? Say `?weather <location>`, or ask an admin to set a default location for #%s"
+)
+
+type WeatherConfig struct {
+  OWMToken string `mapstructure:"owm_token"` // OpenWeatherMap API key
+  OWMBaseURL string `mapstructure:"owm_base_url"` // defaults to DEFAULT_OWM_BASE_URL
+  Channels []WeatherChannelConfig `mapstructure:"channels"`
+  Users []WeatherUserConfig `mapstructure:"users"` // per-user defaults
+  AlertInterval time.Duration `mapstructure:"alert_interval"` // how often to check for alerts, e.g. 15m, the default
+}
+
+// Enabled reports whether any of the weather is configured, in which case it
+// all has to be.
+func (cfg WeatherConfig) Enabled() bool {
+  return cfg.OWMToken != "" || len(cfg.Channels) > 0 || len(cfg.Users) > 0
+}
+
+type WeatherChannelConfig struct {
+  Name string `mapstructure:"name"`
+  ID string `mapstructure:"id"`
+  Location string `mapstructure:"location"`
+  Units string `mapstructure:"units"` // metric, imperial (the default) or standard
+  AlertLocations []string `mapstructure:"alert_locations"` // where to watch for severe weather
+}
+
+type WeatherUserConfig struct {
+  SlackUser string `mapstructure:"slack_user"` // Slack username or user ID
+  Location string `mapstructure:"location"`
+  Units string `mapstructure:"units"`
+}
+
+// WeatherResponse is OpenWeatherMap's current weather, in the units asked for.
+type WeatherResponse struct {
+  Name string `json:"name"`
+  Timezone int `json:"timezone"` // seconds from UTC
+  Coord struct {
+    Lat float64 `json:"lat"`
+    Lon float64 `json:"lon"`
+  } `json:"coord"`
+  Weather []WeatherCondition `json:"weather"`
+  Main struct {
+    Temp float64 `json:"temp"`
+    FeelsLike float64 `json:"feels_like"`
+    Humidity float64 `json:"humidity"`
+  } `json:"main"`
+  Wind struct {
+    Speed float64 `json:"speed"`
+    Deg float64 `json:"deg"`
+  } `json:"wind"`
+  Sys struct {
+    Sunrise int64 `json:"sunrise"`
+    Sunset int64 `json:"sunset"`
+  } `json:"sys"`
+}
+
+type WeatherCondition struct {
+  Description string `json:"description"`
+}
+
 var (
-  openWeatherMapToken string
+  weatherClient *OpenWeatherMapClient
+  weatherConfig WeatherConfig
+  weatherCoordinatesPattern = regexp.MustCompile(WEATHER_COORDINATES_PATTERN)
+  weatherPostalCodePattern = regexp.MustCompile(WEATHER_POSTAL_CODE_PATTERN)
+  weatherTempUnits = map[string]string{
+    WEATHER_UNITS_METRIC: "°C",
+    WEATHER_UNITS_IMPERIAL: "°F",
+    WEATHER_UNITS_STANDARD: "K",
+  }
+  weatherSpeedUnits = map[string]string{
+    WEATHER_UNITS_METRIC: "m/s",
+    WEATHER_UNITS_IMPERIAL: "mph",
+    WEATHER_UNITS_STANDARD: "m/s",
+  }
+  compassPoints = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
 )
 
-func init() {
-  viper := viper.New()
-  viper.SetEnvPrefix("libslackbot")
-  viper.AutomaticEnv()
-  viper.ReadInConfig()
-  openWeatherMapToken = viper.GetString("owm_token")
+func configureWeather(cfg WeatherConfig) {
+  weatherConfig = cfg
+  weatherClient = NewOpenWeatherMapClient(cfg.OWMBaseURL, cfg.OWMToken)
 }
 
-func Weather(bot *slackbot.Bot, channelID string, channelName string, args ...string) {
-  if args == nil {
-    bot.Reply(channelID, "Usage: ?weather zipcode")
+// Weather replies with the current weather, or the forecast, at a location.
+// Without one, it uses the user's default location, then the channel's, and
+// likewise for units.
+func Weather(bot *slackbot.Bot, msg slackbot.Message, args ...string) {
+  var mode, units string
+  for len(args) > 0 {
+    arg := strings.ToLower(args[0])
+    if arg == WEATHER_MODE_FORECAST || arg == WEATHER_MODE_TOMORROW {
+      mode = arg
+    } else if _, ok := weatherTempUnits[arg]; ok {
+      units = arg
+    } else {
+      break
+    }
+    args = args[1:]
+  }
+  location := strings.TrimSpace(strings.Join(args, " "))
+  defaultLocation, defaultUnits := getWeatherDefaults(bot, msg)
+  if location == "" {
+    location = defaultLocation
+  }
+  if units == "" {
+    units = defaultUnits
+  }
+  if location == "" {
+    bot.Reply(msg.ChannelID, fmt.Sprintf(TPL_WEATHER_NO_LOCATION, msg.ChannelName))
+    return
+  }
+  if mode != "" {
+    weatherForecast(bot, msg.ChannelID, mode, location, units)
     return
   }
 
-  url := fmt.Sprintf("http://api.openweathermap.org/data/2.5/weather?zip=%s&appid=%s", args[0], openWeatherMapToken)
-  rs, err := http.Get(url)
+  weather, err := weatherClient.CurrentWeather(location, units)
   if err != nil {
-    panic(err)
+    replyWeatherError(bot, msg.ChannelID, err, location, "getting the weather for")
+    return
   }
-  defer rs.Body.Close()
 
-  bodyBytes, err := ioutil.ReadAll(rs.Body)
-  if err != nil {
-    panic(err)
+  description := "?"
+  if len(weather.Weather) > 0 {
+    description = weather.Weather[0].Description
   }
+  zone := time.FixedZone(weather.Name, weather.Timezone)
+  bot.Reply(msg.ChannelID, fmt.Sprintf(
+    TPL_WEATHER,
+    weather.Name,
+    description,
+    formatTemperature(weather.Main.Temp, units),
+    formatTemperature(weather.Main.FeelsLike, units),
+    int(weather.Main.Humidity),
+    fmt.Sprintf("%.0f %s", weather.Wind.Speed, weatherSpeedUnits[units]),
+    getCompassPoint(weather.Wind.Deg),
+    time.Unix(weather.Sys.Sunrise, 0).In(zone).Format(WEATHER_TIME_FORMAT),
+    time.Unix(weather.Sys.Sunset, 0).In(zone).Format(WEATHER_TIME_FORMAT),
+  ))
+}
 
-  var location, description string
-  var temp, humidity float64
-  c := make(map[string]interface{})
-  err = json.Unmarshal(bodyBytes, &c)
-  if err != nil {
-    panic(err)
+// getWeatherDefaults returns the location and units to use when the request
+// doesn't say: the user's, then the channel's, then DEFAULT_WEATHER_UNITS.
+func getWeatherDefaults(bot *slackbot.Bot, msg slackbot.Message) (string, string) {
+  var userConfig WeatherUserConfig
+  for _, user := range weatherConfig.Users {
+    if isSlackUser(user.SlackUser, msg.UserID, bot.Users()[msg.UserID]) {
+      userConfig = user
+      break
+    }
+  }
+  channelConfig := getWeatherChannelConfig(msg.ChannelID, msg.ChannelName)
+  location, units := userConfig.Location, strings.ToLower(userConfig.Units)
+  if location == "" {
+    location = channelConfig.Location
+  }
+  if units == "" {
+    units = strings.ToLower(channelConfig.Units)
+  }
+  if _, ok := weatherTempUnits[units]; !ok {
+    units = DEFAULT_WEATHER_UNITS
   }
 
-  location = c["name"].(string)
-  if val, ok := c["weather"].([]interface{}); ok {
-    if val, ok := val[0].(map[string]interface{}); ok {
-      description = val["description"].(string)
+  return location, units
+}
+
+func getWeatherChannelConfig(channelID string, channelName string) WeatherChannelConfig {
+  for _, channelConfig := range weatherConfig.Channels {
+    if channelConfig.ID != "" && channelConfig.ID == channelID {
+      return channelConfig
     }
   }
-  if val, ok := c["main"].(map[string]interface{}); ok {
-    temp = func(kelvin float64) float64 {
-      return 1.8 * (kelvin - 273) +32
-      }(val["temp"].(float64))
-      humidity = val["humidity"].(float64)
+  for _, channelConfig := range weatherConfig.Channels {
+    if channelConfig.ID == "" && channelConfig.Name == channelName {
+      return channelConfig
     }
-
-    bot.Reply(
-      channelID,
-      fmt.Sprintf("Weather in %s: %s, %d°F, %d%% humidity", location, description, int(temp), int(humidity)),
-    )
   }
+
+  return WeatherChannelConfig{}
+}
+
+func formatTemperature(temp float64, units string) string {
+  return fmt.Sprintf("%.0f%s", temp, weatherTempUnits[units])
+}
+
+// getCompassPoint turns a wind direction in degrees into e.g. NW.
+func getCompassPoint(deg float64) string {
+  i := int(math.Floor(math.Mod(deg, 360) / 45 + 0.5)) % len(compassPoints)
+
+  return compassPoints[i]
+}
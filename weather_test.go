@@ -0,0 +1,28 @@
+package slackbots
+
+import(
+  "net/http/httptest"
+  "testing"
+
+  "github.com/premshree/slackbots/slackbot"
+)
+
+func TestWeatherFailingBackend(t *testing.T) {
+  defer configureWeather(weatherConfig)
+
+  for _, backend := range failingBackends {
+    t.Run(backend.name, func(t *testing.T) {
+      slack, bot := newFakeSlack()
+      defer slack.close()
+      owm := httptest.NewServer(backend.handler)
+      defer owm.Close()
+      configureWeather(WeatherConfig{OWMToken: "test-token", OWMBaseURL: owm.URL})
+
+      msg := slackbot.Message{ChannelID: "C0TEST", UserID: TEST_USER_ID, Text: "?weather Paris"}
+      runCommand(t, func() {
+        Weather(bot, msg, "Paris")
+      })
+      slack.expectReply(t, "Sorry, I ran into a problem getting the weather for Paris :disappointed:")
+    })
+  }
+}